@@ -2,6 +2,126 @@
 
 #include <string.h>
 
+Mat Mat_New() {
+  return new cv::Mat();
+}
+
+Mat Mat_NewWithData(int rows, int cols, int type, struct ByteArray buf) {
+  cv::Mat* mat = new cv::Mat(rows, cols, type);
+  size_t size = std::min((size_t)buf.length, mat->total() * mat->elemSize());
+  memcpy(mat->data, buf.data, size);
+  return mat;
+}
+
+void Mat_Delete(Mat m) {
+  delete m;
+}
+
+int Mat_Empty(Mat m) {
+  return m->empty();
+}
+
+int Mat_Rows(Mat m) {
+  return m->rows;
+}
+
+int Mat_Cols(Mat m) {
+  return m->cols;
+}
+
+int Mat_Type(Mat m) {
+  return m->type();
+}
+
+int Mat_Channels(Mat m) {
+  return m->channels();
+}
+
+struct ByteArray Mat_ToBytes(Mat m) {
+  cv::Mat cont = m->isContinuous() ? *m : m->clone();
+  return toByteArray(reinterpret_cast<const char*>(cont.data),
+    cont.total() * cont.elemSize());
+}
+
+Mat Mat_CvtColor(Mat m, int code) {
+  cv::Mat* ret = new cv::Mat();
+  try {
+    cv::cvtColor(*m, *ret, code);
+  } catch (cv::Exception& e) {
+    ret->release();
+  }
+  return ret;
+}
+
+Mat Mat_ConvertTo(Mat m, int type, double alpha, double beta) {
+  cv::Mat* ret = new cv::Mat();
+  if (CV_MAT_CN(type) != m->channels()) {
+    return ret;
+  }
+  m->convertTo(*ret, type, alpha, beta);
+  return ret;
+}
+
+Mat Mat_Resize(Mat m, int width, int height, int interpolation) {
+  cv::Mat* ret = new cv::Mat();
+  cv::resize(*m, *ret, cv::Size(width, height), 0, 0, interpolation);
+  return ret;
+}
+
+Mat Mat_Region(Mat m, struct Rect rect) {
+  cv::Rect r = cv::Rect(rect.x, rect.y, rect.width, rect.height) &
+    cv::Rect(0, 0, m->cols, m->rows);
+  if (r.area() == 0) {
+    return new cv::Mat();
+  }
+  return new cv::Mat((*m)(r).clone());
+}
+
+Mat Mat_CopyMakeBorder(Mat m, int top, int bottom, int left, int right,
+    int borderType) {
+  cv::Mat* ret = new cv::Mat();
+  cv::copyMakeBorder(*m, *ret, top, bottom, left, right, borderType,
+    cv::Scalar::all(0));
+  return ret;
+}
+
+Mat Mat_Flip(Mat m, int flipCode) {
+  cv::Mat* ret = new cv::Mat();
+  cv::flip(*m, *ret, flipCode);
+  return ret;
+}
+
+Mat Mat_Transpose(Mat m) {
+  cv::Mat* ret = new cv::Mat();
+  cv::transpose(*m, *ret);
+  return ret;
+}
+
+Mat Mat_Rotate(Mat m, double angle, int borderType) {
+  cv::Mat* ret = new cv::Mat();
+  cv::Point2f center(m->cols / 2.0f, m->rows / 2.0f);
+  cv::Mat rot = cv::getRotationMatrix2D(center, angle, 1.0);
+  cv::warpAffine(*m, *ret, rot, m->size(), cv::INTER_LINEAR, borderType,
+    cv::Scalar::all(0));
+  return ret;
+}
+
+MatVec3b Mat_ToMatVec3b(Mat m) {
+  cv::Mat_<cv::Vec3b>* ret = new cv::Mat_<cv::Vec3b>();
+  switch (m->type()) {
+  case CV_8UC1:
+    cv::cvtColor(*m, *ret, CV_GRAY2BGR);
+    break;
+  case CV_8UC3:
+    m->copyTo(*ret);
+    break;
+  case CV_8UC4:
+    cv::cvtColor(*m, *ret, CV_BGRA2BGR);
+    break;
+  }
+  return ret;
+}
+
 MatVec3b MatVec3b_New() {
   return new cv::Mat_<cv::Vec3b>();
 }
@@ -27,6 +147,14 @@ int MatVec3b_Empty(MatVec3b m) {
   return m->empty();
 }
 
+int MatVec3b_Cols(MatVec3b m) {
+  return m->cols;
+}
+
+int MatVec3b_Rows(MatVec3b m) {
+  return m->rows;
+}
+
 struct RawData MatVec3b_ToRawData(MatVec3b m) {
   int width = m->cols;
   int height = m->rows;
@@ -46,6 +174,41 @@ MatVec3b RawData_ToMatVec3b(struct RawData r) {
   return mat;
 }
 
+int MatVec3b_Encode(MatVec3b m, const char* ext, int* params, int length,
+    struct ByteArray* buf) {
+  std::vector<int> param(params, params + length);
+  std::vector<uchar> data;
+  try {
+    if (!cv::imencode(ext, *m, data, param) || data.empty()) {
+      return 0;
+    }
+  } catch (cv::Exception& e) {
+    return 0;
+  }
+  *buf = toByteArray(reinterpret_cast<const char*>(&data[0]), data.size());
+  return 1;
+}
+
+MatVec3b DecodeToMatVec3b(struct ByteArray buf) {
+  std::vector<uchar> data(buf.data, buf.data + buf.length);
+  cv::Mat_<cv::Vec3b> img = cv::imdecode(data, cv::IMREAD_COLOR);
+  return new cv::Mat_<cv::Vec3b>(img);
+}
+
+MatVec4b MatVec3b_ToMatVec4b(MatVec3b m) {
+  cv::Mat_<cv::Vec4b>* ret = new cv::Mat_<cv::Vec4b>();
+  cv::cvtColor(*m, *ret, CV_BGR2BGRA);
+  return ret;
+}
+
+Mat MatVec3b_ToMat(MatVec3b m) {
+  return new cv::Mat(m->clone());
+}
+
+Mat MatVec3b_ShareMat(MatVec3b m) {
+  return new cv::Mat(*m);
+}
+
 void MatVec4b_Delete(MatVec4b m) {
   delete m;
 }
@@ -69,6 +232,12 @@ MatVec4b RawData_ToMatVec4b(struct RawData r) {
   return mat;
 }
 
+MatVec3b MatVec4b_ToMatVec3b(MatVec4b m) {
+  cv::Mat_<cv::Vec3b>* ret = new cv::Mat_<cv::Vec3b>();
+  cv::cvtColor(*m, *ret, CV_BGRA2BGR);
+  return ret;
+}
+
 VideoCapture VideoCapture_New() {
   return new cv::VideoCapture();
 }
@@ -89,8 +258,12 @@ void VideoCapture_Release(VideoCapture v) {
   v->release();
 }
 
-void VideoCapture_Set(VideoCapture v, int prop, int param) {
-  v->set(prop, param);
+int VideoCapture_Set(VideoCapture v, int prop, double param) {
+  return v->set(prop, param);
+}
+
+double VideoCapture_Get(VideoCapture v, int prop) {
+  return v->get(prop);
 }
 
 int VideoCapture_IsOpened(VideoCapture v) {
@@ -125,6 +298,15 @@ void VideoWriter_OpenWithMat(VideoWriter vw, const char* name, double fps,
   vw->open(name, CV_FOURCC('M', 'J', 'P', 'G'), fps, img->size(), true);
 }
 
+void VideoWriter_OpenWithCodec(VideoWriter vw, const char* name, int fourcc,
+    double fps, int width, int height) {
+  vw->open(name, fourcc, fps, cv::Size(width, height), true);
+}
+
+void VideoWriter_Release(VideoWriter vw) {
+  vw->release();
+}
+
 int VideoWriter_IsOpened(VideoWriter vw) {
   return vw->isOpened();
 }
@@ -145,22 +327,139 @@ int CascadeClassifier_Load(CascadeClassifier cs, const char* name) {
   return cs->load(name);
 }
 
-struct Rects CascadeClassifier_DetectMultiScale(CascadeClassifier cs, MatVec3b img) {
+// detectScale returns the scale of the detection image, zero means no scaling.
+static double detectScale(const struct DetectParams& params) {
+  return params.detectScale > 0 ? params.detectScale : 1;
+}
+
+static cv::Size scaleSize(int width, int height, double scale) {
+  return cv::Size(cvRound(width * scale), cvRound(height * scale));
+}
+
+// prepareDetectImage returns the image which is resized, converted to
+// grayscale and equalized following the parameters. An empty image is
+// returned when the resized image has no pixels.
+static cv::Mat prepareDetectImage(const cv::Mat& img,
+    const struct DetectParams& params) {
+  cv::Mat ret = img;
+  double scale = detectScale(params);
+  if (scale != 1) {
+    cv::Size size = scaleSize(img.cols, img.rows, scale);
+    if (size.width < 1 || size.height < 1) {
+      return cv::Mat();
+    }
+    cv::Mat resized;
+    cv::resize(ret, resized, size, 0, 0, cv::INTER_AREA);
+    ret = resized;
+  }
+  if (params.grayscale || params.equalizeHist) {
+    cv::Mat gray;
+    cv::cvtColor(ret, gray, CV_BGR2GRAY);
+    ret = gray;
+  }
+  if (params.equalizeHist) {
+    cv::equalizeHist(ret, ret);
+  }
+  return ret;
+}
+
+// detectROI returns the region of the image to detect, which is clipped by
+// the image. Zero width or height means the whole image.
+static cv::Rect detectROI(const cv::Mat& img, const struct DetectParams& params) {
+  cv::Rect whole(0, 0, img.cols, img.rows);
+  if (params.roi.width <= 0 || params.roi.height <= 0) {
+    return whole;
+  }
+  cv::Rect roi(params.roi.x, params.roi.y, params.roi.width, params.roi.height);
+  return roi & whole;
+}
+
+// emptyDetectRegion returns true when the region clipped by the image has no
+// pixels to detect after scaling.
+static bool emptyDetectRegion(const cv::Rect& roi, double scale) {
+  cv::Size size = scaleSize(roi.width, roi.height, scale);
+  return roi.area() == 0 || size.width < 1 || size.height < 1;
+}
+
+// toOriginalRect maps the rectangle on the detection image back to the
+// original image.
+static Rect toOriginalRect(const cv::Rect& r, double scale, const cv::Rect& roi) {
+  Rect ret = {cvRound(r.x / scale) + roi.x, cvRound(r.y / scale) + roi.y,
+    cvRound(r.width / scale), cvRound(r.height / scale)};
+  return ret;
+}
+
+struct Rects CascadeClassifier_DetectMultiScale(CascadeClassifier cs, MatVec3b img,
+    struct DetectParams params) {
+  double scale = detectScale(params);
+  cv::Rect roi = detectROI(*img, params);
   std::vector<cv::Rect> faces;
-  cs->detectMultiScale(*img, faces); // TODO control default parameter
+  if (emptyDetectRegion(roi, scale)) {
+    Rects ret = {new Rect[0], 0};
+    return ret;
+  }
+  try {
+    cv::Mat target = prepareDetectImage((*img)(roi), params);
+    if (!target.empty()) {
+      cs->detectMultiScale(target, faces, params.scaleFactor,
+        params.minNeighbors, params.flags,
+        scaleSize(params.minWidth, params.minHeight, scale),
+        scaleSize(params.maxWidth, params.maxHeight, scale));
+    }
+  } catch (cv::Exception& e) {
+    faces.clear();
+  }
   Rect* rects = new Rect[faces.size()];
   for (size_t i = 0; i < faces.size(); ++i) {
-    Rect r = {faces[i].x, faces[i].y, faces[i].width, faces[i].height};
-    rects[i] = r;
+    rects[i] = toOriginalRect(faces[i], scale, roi);
   }
   Rects ret = {rects, (int)faces.size()};
   return ret;
 }
 
+struct DetectedObjects CascadeClassifier_DetectMultiScaleWithLevels(
+    CascadeClassifier cs, MatVec3b img, struct DetectParams params) {
+  double scale = detectScale(params);
+  cv::Rect roi = detectROI(*img, params);
+  if (emptyDetectRegion(roi, scale)) {
+    DetectedObjects ret = {new DetectedObject[0], 0};
+    return ret;
+  }
+  std::vector<cv::Rect> faces;
+  std::vector<int> levels;
+  std::vector<double> weights;
+  try {
+    cv::Mat target = prepareDetectImage((*img)(roi), params);
+    if (!target.empty()) {
+      cs->detectMultiScale(target, faces, levels, weights, params.scaleFactor,
+        params.minNeighbors, params.flags,
+        scaleSize(params.minWidth, params.minHeight, scale),
+        scaleSize(params.maxWidth, params.maxHeight, scale), true);
+    }
+  } catch (cv::Exception& e) {
+    faces.clear();
+  }
+  DetectedObject* objects = new DetectedObject[faces.size()];
+  for (size_t i = 0; i < faces.size(); ++i) {
+    DetectedObject o = {
+      toOriginalRect(faces[i], scale, roi),
+      i < levels.size() ? levels[i] : 0,
+      i < weights.size() ? weights[i] : 0,
+    };
+    objects[i] = o;
+  }
+  DetectedObjects ret = {objects, (int)faces.size()};
+  return ret;
+}
+
 void Rects_Delete(struct Rects rs) {
   delete rs.rects;
 }
 
+void DetectedObjects_Delete(struct DetectedObjects os) {
+  delete[] os.objects;
+}
+
 void DrawRectsToImage(MatVec3b img, struct Rects rects) {
   for (int i = 0; i < rects.length; ++i) {
     Rect r = rects.rects[i];
@@ -169,6 +468,67 @@ void DrawRectsToImage(MatVec3b img, struct Rects rects) {
   }
 }
 
+static cv::Scalar toScalar(struct Color color) {
+  return cv::Scalar(color.b, color.g, color.r);
+}
+
+void DrawRect(MatVec3b img, struct Rect rect, struct Color color, int thickness) {
+  cv::rectangle(*img, cv::Point(rect.x, rect.y),
+    cv::Point(rect.x+rect.width, rect.y+rect.height), toScalar(color),
+    thickness, CV_AA);
+}
+
+void DrawLabel(MatVec3b img, struct Rect rect, const char* label, double fontScale,
+    struct Color color, int thickness) {
+  int baseline = 0;
+  cv::Size size = cv::getTextSize(label, cv::FONT_HERSHEY_SIMPLEX, fontScale,
+    thickness, &baseline);
+  // put the label above the rectangle, or inside when there is no space
+  int y = rect.y - baseline;
+  if (y - size.height < 0) {
+    y = rect.y + size.height + baseline;
+  }
+  cv::putText(*img, label, cv::Point(rect.x, y), cv::FONT_HERSHEY_SIMPLEX,
+    fontScale, toScalar(color), thickness, CV_AA);
+}
+
+void DrawText(MatVec3b img, const char* text, struct Point org, double fontScale,
+    struct Color color, int thickness) {
+  cv::putText(*img, text, cv::Point(org.x, org.y), cv::FONT_HERSHEY_SIMPLEX,
+    fontScale, toScalar(color), thickness, CV_AA);
+}
+
+void DrawLine(MatVec3b img, struct Point pt1, struct Point pt2, struct Color color,
+    int thickness) {
+  cv::line(*img, cv::Point(pt1.x, pt1.y), cv::Point(pt2.x, pt2.y),
+    toScalar(color), thickness, CV_AA);
+}
+
+void DrawCircle(MatVec3b img, struct Point center, int radius, struct Color color,
+    int thickness) {
+  cv::circle(*img, cv::Point(center.x, center.y), radius, toScalar(color),
+    thickness, CV_AA);
+}
+
+static std::vector<cv::Point> toCvPoints(struct Points pts) {
+  std::vector<cv::Point> ret;
+  for (int i = 0; i < pts.length; ++i) {
+    ret.push_back(cv::Point(pts.points[i].x, pts.points[i].y));
+  }
+  return ret;
+}
+
+void DrawPolylines(MatVec3b img, struct Points pts, int isClosed, struct Color color,
+    int thickness) {
+  std::vector<std::vector<cv::Point> > polys(1, toCvPoints(pts));
+  cv::polylines(*img, polys, isClosed != 0, toScalar(color), thickness, CV_AA);
+}
+
+void FillPoly(MatVec3b img, struct Points pts, struct Color color) {
+  std::vector<std::vector<cv::Point> > polys(1, toCvPoints(pts));
+  cv::fillPoly(*img, polys, toScalar(color), CV_AA);
+}
+
 MatVec4b LoadAlphaImg(const char* name) {
   cv::Mat_<cv::Vec4b> img = cv::imread(name, cv::IMREAD_UNCHANGED);
   return new cv::Mat_<cv::Vec4b>(img);
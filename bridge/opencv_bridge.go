@@ -15,14 +15,320 @@ import (
 )
 
 const (
+	// CvCapPropPosMsec is OpenCV parameter of position in milliseconds
+	CvCapPropPosMsec = 0
+	// CvCapPropPosFrames is OpenCV parameter of index of the next frame
+	CvCapPropPosFrames = 1
+	// CvCapPropPosAviRatio is OpenCV parameter of relative position of video
+	CvCapPropPosAviRatio = 2
 	// CvCapPropFrameWidth is OpenCV parameter of Frame Width
 	CvCapPropFrameWidth = 3
 	// CvCapPropFrameHeight is OpenCV parameter of Frame Height
 	CvCapPropFrameHeight = 4
 	// CvCapPropFps is OpenCV parameter of FPS
 	CvCapPropFps = 5
+	// CvCapPropFourcc is OpenCV parameter of codec FourCC
+	CvCapPropFourcc = 6
+	// CvCapPropFrameCount is OpenCV parameter of number of frames
+	CvCapPropFrameCount = 7
+	// CvCapPropFormat is OpenCV parameter of Mat format
+	CvCapPropFormat = 8
+	// CvCapPropMode is OpenCV parameter of capture mode
+	CvCapPropMode = 9
+	// CvCapPropBrightness is OpenCV parameter of brightness of the image
+	CvCapPropBrightness = 10
+	// CvCapPropContrast is OpenCV parameter of contrast of the image
+	CvCapPropContrast = 11
+	// CvCapPropSaturation is OpenCV parameter of saturation of the image
+	CvCapPropSaturation = 12
+	// CvCapPropHue is OpenCV parameter of hue of the image
+	CvCapPropHue = 13
+	// CvCapPropGain is OpenCV parameter of gain of the image
+	CvCapPropGain = 14
+	// CvCapPropExposure is OpenCV parameter of exposure
+	CvCapPropExposure = 15
+	// CvCapPropConvertRGB is OpenCV parameter of RGB conversion flag
+	CvCapPropConvertRGB = 16
+	// CvCapPropWhiteBalanceBlueU is OpenCV parameter of U value of white balance
+	CvCapPropWhiteBalanceBlueU = 17
+	// CvCapPropRectification is OpenCV parameter of rectification flag
+	CvCapPropRectification = 18
+	// CvCapPropMonochrome is OpenCV parameter of monochrome flag
+	CvCapPropMonochrome = 19
+	// CvCapPropSharpness is OpenCV parameter of sharpness
+	CvCapPropSharpness = 20
+	// CvCapPropAutoExposure is OpenCV parameter of auto exposure
+	CvCapPropAutoExposure = 21
+	// CvCapPropGamma is OpenCV parameter of gamma
+	CvCapPropGamma = 22
+	// CvCapPropTemperature is OpenCV parameter of color temperature
+	CvCapPropTemperature = 23
+	// CvCapPropTrigger is OpenCV parameter of trigger
+	CvCapPropTrigger = 24
+	// CvCapPropTriggerDelay is OpenCV parameter of trigger delay
+	CvCapPropTriggerDelay = 25
+	// CvCapPropWhiteBalanceRedV is OpenCV parameter of V value of white balance
+	CvCapPropWhiteBalanceRedV = 26
+	// CvCapPropZoom is OpenCV parameter of zoom
+	CvCapPropZoom = 27
+	// CvCapPropFocus is OpenCV parameter of focus
+	CvCapPropFocus = 28
+	// CvCapPropGUID is OpenCV parameter of GUID
+	CvCapPropGUID = 29
+	// CvCapPropIsoSpeed is OpenCV parameter of ISO speed
+	CvCapPropIsoSpeed = 30
+	// CvCapPropBacklight is OpenCV parameter of backlight compensation
+	CvCapPropBacklight = 32
+	// CvCapPropPan is OpenCV parameter of pan
+	CvCapPropPan = 33
+	// CvCapPropTilt is OpenCV parameter of tilt
+	CvCapPropTilt = 34
+	// CvCapPropRoll is OpenCV parameter of roll
+	CvCapPropRoll = 35
+	// CvCapPropIris is OpenCV parameter of iris
+	CvCapPropIris = 36
+	// CvCapPropSettings is OpenCV parameter of settings dialog flag
+	CvCapPropSettings = 37
+	// CvCapPropBuffersize is OpenCV parameter of buffer size
+	CvCapPropBuffersize = 38
+	// CvCapPropAutofocus is OpenCV parameter of auto focus flag
+	CvCapPropAutofocus = 39
 )
 
+const (
+	// CvImwriteJpegQuality is OpenCV parameter of JPEG quality
+	CvImwriteJpegQuality = 1
+	// CvImwritePngCompression is OpenCV parameter of PNG compression level
+	CvImwritePngCompression = 16
+	// CvImwriteWebpQuality is OpenCV parameter of WebP quality
+	CvImwriteWebpQuality = 64
+)
+
+const (
+	// CvDepth8U is OpenCV depth of 8-bit unsigned integer
+	CvDepth8U = 0
+	// CvDepth8S is OpenCV depth of 8-bit signed integer
+	CvDepth8S = 1
+	// CvDepth16U is OpenCV depth of 16-bit unsigned integer
+	CvDepth16U = 2
+	// CvDepth16S is OpenCV depth of 16-bit signed integer
+	CvDepth16S = 3
+	// CvDepth32S is OpenCV depth of 32-bit signed integer
+	CvDepth32S = 4
+	// CvDepth32F is OpenCV depth of 32-bit float
+	CvDepth32F = 5
+	// CvDepth64F is OpenCV depth of 64-bit float
+	CvDepth64F = 6
+)
+
+// CvMakeType returns OpenCV Mat type of the depth and the number of channels
+// same as `CV_MAKETYPE`.
+func CvMakeType(depth int, channels int) int {
+	return (depth & 7) + ((channels - 1) << 3)
+}
+
+// CvMatDepth returns the depth of OpenCV Mat type same as `CV_MAT_DEPTH`.
+func CvMatDepth(matType int) int {
+	return matType & 7
+}
+
+const (
+	// CvBGR2BGRA is OpenCV color conversion code from BGR to BGRA
+	CvBGR2BGRA = 0
+	// CvRGB2RGBA is OpenCV color conversion code from RGB to RGBA
+	CvRGB2RGBA = CvBGR2BGRA
+	// CvBGRA2BGR is OpenCV color conversion code from BGRA to BGR
+	CvBGRA2BGR = 1
+	// CvRGBA2RGB is OpenCV color conversion code from RGBA to RGB
+	CvRGBA2RGB = CvBGRA2BGR
+	// CvBGR2RGBA is OpenCV color conversion code from BGR to RGBA
+	CvBGR2RGBA = 2
+	// CvRGB2BGRA is OpenCV color conversion code from RGB to BGRA
+	CvRGB2BGRA = CvBGR2RGBA
+	// CvRGBA2BGR is OpenCV color conversion code from RGBA to BGR
+	CvRGBA2BGR = 3
+	// CvBGRA2RGB is OpenCV color conversion code from BGRA to RGB
+	CvBGRA2RGB = CvRGBA2BGR
+	// CvBGR2RGB is OpenCV color conversion code from BGR to RGB
+	CvBGR2RGB = 4
+	// CvRGB2BGR is OpenCV color conversion code from RGB to BGR
+	CvRGB2BGR = CvBGR2RGB
+	// CvBGRA2RGBA is OpenCV color conversion code from BGRA to RGBA
+	CvBGRA2RGBA = 5
+	// CvRGBA2BGRA is OpenCV color conversion code from RGBA to BGRA
+	CvRGBA2BGRA = CvBGRA2RGBA
+	// CvBGR2GRAY is OpenCV color conversion code from BGR to GRAY
+	CvBGR2GRAY = 6
+	// CvRGB2GRAY is OpenCV color conversion code from RGB to GRAY
+	CvRGB2GRAY = 7
+	// CvGRAY2BGR is OpenCV color conversion code from GRAY to BGR
+	CvGRAY2BGR = 8
+	// CvGRAY2RGB is OpenCV color conversion code from GRAY to RGB
+	CvGRAY2RGB = CvGRAY2BGR
+	// CvGRAY2BGRA is OpenCV color conversion code from GRAY to BGRA
+	CvGRAY2BGRA = 9
+	// CvGRAY2RGBA is OpenCV color conversion code from GRAY to RGBA
+	CvGRAY2RGBA = CvGRAY2BGRA
+	// CvBGRA2GRAY is OpenCV color conversion code from BGRA to GRAY
+	CvBGRA2GRAY = 10
+	// CvRGBA2GRAY is OpenCV color conversion code from RGBA to GRAY
+	CvRGBA2GRAY = 11
+)
+
+const (
+	// CvInterNearest is OpenCV nearest neighbor interpolation
+	CvInterNearest = 0
+	// CvInterLinear is OpenCV bilinear interpolation
+	CvInterLinear = 1
+	// CvInterCubic is OpenCV bicubic interpolation
+	CvInterCubic = 2
+	// CvInterArea is OpenCV resampling using pixel area relation
+	CvInterArea = 3
+)
+
+const (
+	// CvBorderConstant is OpenCV border type filled with black
+	CvBorderConstant = 0
+	// CvBorderReplicate is OpenCV border type replicating the edge pixels
+	CvBorderReplicate = 1
+	// CvBorderReflect is OpenCV border type reflecting the image
+	CvBorderReflect = 2
+	// CvBorderWrap is OpenCV border type wrapping the image
+	CvBorderWrap = 3
+	// CvBorderReflect101 is OpenCV border type reflecting the image without
+	// the edge pixels
+	CvBorderReflect101 = 4
+)
+
+// Mat is a bind of `cv::Mat`, which can have any depth and channels.
+type Mat struct {
+	p C.Mat
+}
+
+// NewMat returns a new empty Mat.
+func NewMat() Mat {
+	return Mat{p: C.Mat_New()}
+}
+
+// NewMatWithData returns a new Mat which has a copy of data. matType is
+// OpenCV Mat type, see CvMakeType. Returned Mat is required to delete after
+// using.
+func NewMatWithData(rows int, cols int, matType int, data []byte) Mat {
+	if len(data) == 0 {
+		return NewMat()
+	}
+	return Mat{p: C.Mat_NewWithData(C.int(rows), C.int(cols), C.int(matType),
+		toByteArray(data))}
+}
+
+// Delete object.
+func (m *Mat) Delete() {
+	C.Mat_Delete(m.p)
+	m.p = nil
+}
+
+// Empty returns the Mat is empty or not.
+func (m *Mat) Empty() bool {
+	return C.Mat_Empty(m.p) != 0
+}
+
+// Rows returns the number of rows.
+func (m *Mat) Rows() int {
+	return int(C.Mat_Rows(m.p))
+}
+
+// Cols returns the number of columns.
+func (m *Mat) Cols() int {
+	return int(C.Mat_Cols(m.p))
+}
+
+// Type returns OpenCV Mat type.
+func (m *Mat) Type() int {
+	return int(C.Mat_Type(m.p))
+}
+
+// Channels returns the number of channels.
+func (m *Mat) Channels() int {
+	return int(C.Mat_Channels(m.p))
+}
+
+// ToBytes returns a copy of the Mat's data.
+func (m *Mat) ToBytes() []byte {
+	b := C.Mat_ToBytes(m.p)
+	defer C.ByteArray_Release(b)
+	return toGoBytes(b)
+}
+
+// CvtColor converts color space of the Mat with the code (e.g. CvBGR2GRAY).
+// Returned Mat is required to delete after using, and is empty when the Mat
+// cannot be converted by the code.
+func (m *Mat) CvtColor(code int) Mat {
+	return Mat{p: C.Mat_CvtColor(m.p, C.int(code))}
+}
+
+// ConvertTo converts the Mat to the type with scaling by alpha and beta.
+// Returned Mat is required to delete after using, and is empty when the
+// number of channels is different.
+func (m *Mat) ConvertTo(matType int, alpha float64, beta float64) Mat {
+	return Mat{p: C.Mat_ConvertTo(m.p, C.int(matType), C.double(alpha),
+		C.double(beta))}
+}
+
+// Resize resizes the Mat to the size with the interpolation (e.g.
+// CvInterLinear). Returned Mat is required to delete after using.
+func (m *Mat) Resize(width, height, interpolation int) Mat {
+	return Mat{p: C.Mat_Resize(m.p, C.int(width), C.int(height),
+		C.int(interpolation))}
+}
+
+// Region returns a copy of the region of the Mat. The region is clipped by
+// the Mat. Returned Mat is required to delete after using, and is empty when
+// the region is out of the Mat.
+func (m *Mat) Region(rect Rect) Mat {
+	return Mat{p: C.Mat_Region(m.p, rect.toC())}
+}
+
+// CopyMakeBorder returns the Mat surrounded by borders of the type (e.g.
+// CvBorderConstant). Constant borders are black. Returned Mat is required to
+// delete after using.
+func (m *Mat) CopyMakeBorder(top, bottom, left, right, borderType int) Mat {
+	return Mat{p: C.Mat_CopyMakeBorder(m.p, C.int(top), C.int(bottom),
+		C.int(left), C.int(right), C.int(borderType))}
+}
+
+// Flip flips the Mat around the axis. flipCode 0 flips vertically, a
+// positive value flips horizontally and a negative value flips both.
+// Returned Mat is required to delete after using.
+func (m *Mat) Flip(flipCode int) Mat {
+	return Mat{p: C.Mat_Flip(m.p, C.int(flipCode))}
+}
+
+// Transpose transposes the Mat. Returned Mat is required to delete after
+// using.
+func (m *Mat) Transpose() Mat {
+	return Mat{p: C.Mat_Transpose(m.p)}
+}
+
+// Rotate rotates the Mat counterclockwise by the angle in degrees around the
+// center. The size of the Mat is kept, and the outside of the original Mat is
+// filled by the border type (e.g. CvBorderConstant). Returned Mat is required
+// to delete after using.
+func (m *Mat) Rotate(angle float64, borderType int) Mat {
+	return Mat{p: C.Mat_Rotate(m.p, C.double(angle), C.int(borderType))}
+}
+
+// ToMatVec3b converts the Mat of 8-bit 1, 3 or 4 channels to MatVec3b.
+// Returned MatVec3b is required to delete after using. It returns `false`
+// when the type of the Mat is not supported.
+func (m *Mat) ToMatVec3b() (MatVec3b, bool) {
+	ret := MatVec3b{p: C.Mat_ToMatVec3b(m.p)}
+	if ret.Empty() && !m.Empty() {
+		ret.Delete()
+		return MatVec3b{}, false
+	}
+	return ret, true
+}
+
 // CMatVec3b is an alias for C pointer.
 type CMatVec3b C.MatVec3b
 
@@ -70,6 +376,11 @@ func (m *MatVec3b) Empty() bool {
 	return isEmpty != 0
 }
 
+// Size returns the width and the height of MatVec3b.
+func (m *MatVec3b) Size() (int, int) {
+	return int(C.MatVec3b_Cols(m.p)), int(C.MatVec3b_Rows(m.p))
+}
+
 // ToRawData converts MatVec3b to RawData.
 func (m *MatVec3b) ToRawData() (int, int, []byte) {
 	r := C.MatVec3b_ToRawData(m.p)
@@ -87,6 +398,54 @@ func ToMatVec3b(width int, height int, data []byte) MatVec3b {
 	return MatVec3b{p: C.RawData_ToMatVec3b(cr)}
 }
 
+// Encode encodes MatVec3b to the image format of the extension (e.g. ".png")
+// using `cv::imencode`. params are pairs of `CvImwrite*` and the value.
+// Returns `false` when the format is not supported by OpenCV build.
+func (m *MatVec3b) Encode(ext string, params []int) ([]byte, bool) {
+	cExt := C.CString(ext)
+	defer C.free(unsafe.Pointer(cExt))
+	cParams := make([]C.int, len(params)+1) // +1 not to refer empty slice
+	for i, p := range params {
+		cParams[i] = C.int(p)
+	}
+	var b C.struct_ByteArray
+	if C.MatVec3b_Encode(m.p, cExt, &cParams[0], C.int(len(params)), &b) == 0 {
+		return nil, false
+	}
+	defer C.ByteArray_Release(b)
+	return toGoBytes(b), true
+}
+
+// DecodeToMatVec3b decodes image data (e.g. JPEG, PNG) to MatVec3b using
+// `cv::imdecode`. Returned MatVec3b is required to delete after using, and
+// is empty when the data cannot be decoded.
+func DecodeToMatVec3b(b []byte) MatVec3b {
+	if len(b) == 0 {
+		return NewMatVec3b()
+	}
+	return MatVec3b{p: C.DecodeToMatVec3b(toByteArray(b))}
+}
+
+// ToMatVec4b converts MatVec3b to MatVec4b with opaque alpha channel.
+// Returned MatVec4b is required to delete after using.
+func (m *MatVec3b) ToMatVec4b() MatVec4b {
+	return MatVec4b{p: C.MatVec3b_ToMatVec4b(m.p)}
+}
+
+// ToMat converts MatVec3b to Mat. Returned Mat is required to delete after
+// using.
+func (m *MatVec3b) ToMat() Mat {
+	return Mat{p: C.MatVec3b_ToMat(m.p)}
+}
+
+// ShareMat returns a Mat header which shares the data of MatVec3b without
+// copying. The data must not be modified through the Mat, and the Mat can be
+// used while the data is not changed by MatVec3b. Returned Mat is required to
+// delete after using, which doesn't free the data of MatVec3b.
+func (m *MatVec3b) ShareMat() Mat {
+	return Mat{p: C.MatVec3b_ShareMat(m.p)}
+}
+
 // MatVec4b is a bind of `cv::Mat_<cv::Vec4b>`
 type MatVec4b struct {
 	p C.MatVec4b
@@ -115,6 +474,12 @@ func ToMatVec4b(width int, height int, data []byte) MatVec4b {
 	return MatVec4b{p: C.RawData_ToMatVec4b(cr)}
 }
 
+// ToMatVec3b converts MatVec4b to MatVec3b dropping alpha channel. Returned
+// MatVec3b is required to delete after using.
+func (m *MatVec4b) ToMatVec3b() MatVec3b {
+	return MatVec3b{p: C.MatVec4b_ToMatVec3b(m.p)}
+}
+
 // VideoCapture is a bind of `cv::VideoCapture`.
 type VideoCapture struct {
 	p C.VideoCapture
@@ -148,9 +513,15 @@ func (v *VideoCapture) Release() {
 	C.VideoCapture_Release(v.p)
 }
 
-// Set parameter with property (=key).
-func (v *VideoCapture) Set(prop int, param int) {
-	C.VideoCapture_Set(v.p, C.int(prop), C.int(param))
+// Set parameter with property (=key), returns `false` when the property is
+// not supported by the backend.
+func (v *VideoCapture) Set(prop int, param float64) bool {
+	return C.VideoCapture_Set(v.p, C.int(prop), C.double(param)) != 0
+}
+
+// Get returns the value of the property (=key).
+func (v *VideoCapture) Get(prop int) float64 {
+	return float64(C.VideoCapture_Get(v.p, C.int(prop)))
 }
 
 // IsOpened returns the video capture opens a file(or device) or not.
@@ -170,6 +541,12 @@ func (v *VideoCapture) Grab(skip int) {
 	C.VideoCapture_Grab(v.p, C.int(skip))
 }
 
+// FourCC returns a four character code of a codec same as `CV_FOURCC`,
+// e.g. FourCC('M', 'J', 'P', 'G').
+func FourCC(c1, c2, c3, c4 byte) int {
+	return int(c1) | int(c2)<<8 | int(c3)<<16 | int(c4)<<24
+}
+
 // VideoWriter is a bind of `cv::VideoWriter`.
 type VideoWriter struct {
 	mu sync.RWMutex
@@ -201,6 +578,23 @@ func (vw *VideoWriter) OpenWithMat(name string, fps float64, img MatVec3b) {
 	C.VideoWriter_OpenWithMat(vw.p, cName, C.double(fps), img.p)
 }
 
+// OpenWithCodec opens a video writer with the codec specified by the four
+// character code, see FourCC.
+func (vw *VideoWriter) OpenWithCodec(name string, fourcc int, fps float64,
+	width int, height int) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	C.VideoWriter_OpenWithCodec(vw.p, cName, C.int(fourcc), C.double(fps),
+		C.int(width), C.int(height))
+}
+
+// Release closes the video file.
+func (vw *VideoWriter) Release() {
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	C.VideoWriter_Release(vw.p)
+}
+
 // IsOpened returns the video writer opens a file or not.
 func (vw *VideoWriter) IsOpened() bool {
 	isOpend := C.VideoWriter_IsOpened(vw.p)
@@ -245,12 +639,120 @@ type Rect struct {
 	Height int
 }
 
+// DetectParams is parameters of `cv::CascadeClassifier::detectMultiScale`.
+// Zero sizes mean no limit. The image is resized by DetectScale, converted to
+// grayscale and equalized before the detection, and detected rectangles are
+// mapped back to the original image. Sizes are given in the original image.
+// When ROI has positive width and height, only the region is detected.
+type DetectParams struct {
+	ScaleFactor  float64
+	MinNeighbors int
+	Flags        int
+	MinWidth     int
+	MinHeight    int
+	MaxWidth     int
+	MaxHeight    int
+	Grayscale    bool
+	EqualizeHist bool
+	DetectScale  float64
+	ROI          Rect
+}
+
+// NewDetectParams returns DetectParams which has the default values of
+// OpenCV.
+func NewDetectParams() DetectParams {
+	return DetectParams{
+		ScaleFactor:  1.1,
+		MinNeighbors: 3,
+		DetectScale:  1,
+	}
+}
+
+func (p *DetectParams) toC() C.struct_DetectParams {
+	return C.struct_DetectParams{
+		scaleFactor:  C.double(p.ScaleFactor),
+		minNeighbors: C.int(p.MinNeighbors),
+		flags:        C.int(p.Flags),
+		minWidth:     C.int(p.MinWidth),
+		minHeight:    C.int(p.MinHeight),
+		maxWidth:     C.int(p.MaxWidth),
+		maxHeight:    C.int(p.MaxHeight),
+		grayscale:    boolToCInt(p.Grayscale),
+		equalizeHist: boolToCInt(p.EqualizeHist),
+		detectScale:  C.double(p.DetectScale),
+		roi: C.struct_Rect{
+			x:      C.int(p.ROI.X),
+			y:      C.int(p.ROI.Y),
+			width:  C.int(p.ROI.Width),
+			height: C.int(p.ROI.Height),
+		},
+	}
+}
+
+func boolToCInt(b bool) C.int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 // DetectMultiScale detects something which is decided by loaded file. Returns
 // multi results addressed with rectangle.
 func (c *CascadeClassifier) DetectMultiScale(img MatVec3b) []Rect {
-	ret := C.CascadeClassifier_DetectMultiScale(c.p, img.p)
+	return c.DetectMultiScaleWithParams(img, NewDetectParams())
+}
+
+// DetectMultiScaleWithParams detects something which is decided by loaded
+// file with the parameters.
+func (c *CascadeClassifier) DetectMultiScaleWithParams(img MatVec3b,
+	params DetectParams) []Rect {
+	ret := C.CascadeClassifier_DetectMultiScale(c.p, img.p, params.toC())
 	defer C.Rects_Delete(ret)
+	return toGoRects(ret)
+}
+
+// DetectedObject is a detected rectangle with its reject level and the weight
+// of the level, which can be used as the confidence of the detection.
+type DetectedObject struct {
+	Rect   Rect
+	Level  int
+	Weight float64
+}
+
+// DetectMultiScaleWithLevels detects something which is decided by loaded
+// file with the parameters, and returns reject levels and level weights of
+// the results as well.
+func (c *CascadeClassifier) DetectMultiScaleWithLevels(img MatVec3b,
+	params DetectParams) []DetectedObject {
+	ret := C.CascadeClassifier_DetectMultiScaleWithLevels(c.p, img.p,
+		params.toC())
+	defer C.DetectedObjects_Delete(ret)
 
+	length := int(ret.length)
+	hdr := reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(ret.objects)),
+		Len:  length,
+		Cap:  length,
+	}
+	goSlice := *(*[]C.DetectedObject)(unsafe.Pointer(&hdr))
+
+	objects := make([]DetectedObject, length)
+	for i, o := range goSlice {
+		objects[i] = DetectedObject{
+			Rect: Rect{
+				X:      int(o.rect.x),
+				Y:      int(o.rect.y),
+				Width:  int(o.rect.width),
+				Height: int(o.rect.height),
+			},
+			Level:  int(o.level),
+			Weight: float64(o.weight),
+		}
+	}
+	return objects
+}
+
+func toGoRects(ret C.struct_Rects) []Rect {
 	cArray := ret.rects
 	length := int(ret.length)
 	hdr := reflect.SliceHeader{
@@ -291,6 +793,108 @@ func DrawRectsToImage(img MatVec3b, rects []Rect) {
 	C.DrawRectsToImage(img.p, cRects)
 }
 
+// Color represents a color of 3 channels image in BGR order.
+type Color struct {
+	B int
+	G int
+	R int
+}
+
+func (c *Color) toC() C.struct_Color {
+	return C.struct_Color{
+		b: C.int(c.B),
+		g: C.int(c.G),
+		r: C.int(c.R),
+	}
+}
+
+func (r *Rect) toC() C.struct_Rect {
+	return C.struct_Rect{
+		x:      C.int(r.X),
+		y:      C.int(r.Y),
+		width:  C.int(r.Width),
+		height: C.int(r.Height),
+	}
+}
+
+// DrawRect draws a rectangle to target image with the color and thickness.
+func DrawRect(img MatVec3b, rect Rect, color Color, thickness int) {
+	C.DrawRect(img.p, rect.toC(), color.toC(), C.int(thickness))
+}
+
+// DrawLabel draws a label text above the rectangle. The label is drawn inside
+// the rectangle when there is no space above it.
+func DrawLabel(img MatVec3b, rect Rect, label string, fontScale float64,
+	color Color, thickness int) {
+	cLabel := C.CString(label)
+	defer C.free(unsafe.Pointer(cLabel))
+	C.DrawLabel(img.p, rect.toC(), cLabel, C.double(fontScale), color.toC(),
+		C.int(thickness))
+}
+
+// Point represents a point of an image.
+type Point struct {
+	X int
+	Y int
+}
+
+func (p *Point) toC() C.struct_Point {
+	return C.struct_Point{
+		x: C.int(p.X),
+		y: C.int(p.Y),
+	}
+}
+
+// DrawText draws a text to target image. org is the bottom-left corner of the
+// text.
+func DrawText(img MatVec3b, text string, org Point, fontScale float64,
+	color Color, thickness int) {
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+	C.DrawText(img.p, cText, org.toC(), C.double(fontScale), color.toC(),
+		C.int(thickness))
+}
+
+// DrawLine draws a line segment from pt1 to pt2 to target image.
+func DrawLine(img MatVec3b, pt1, pt2 Point, color Color, thickness int) {
+	C.DrawLine(img.p, pt1.toC(), pt2.toC(), color.toC(), C.int(thickness))
+}
+
+// DrawCircle draws a circle to target image. A negative thickness fills the
+// circle.
+func DrawCircle(img MatVec3b, center Point, radius int, color Color,
+	thickness int) {
+	C.DrawCircle(img.p, center.toC(), C.int(radius), color.toC(),
+		C.int(thickness))
+}
+
+func toCPoints(pts []Point) C.struct_Points {
+	cPointArray := make([]C.struct_Point, len(pts))
+	for i, p := range pts {
+		cPointArray[i] = p.toC()
+	}
+	cPoints := C.struct_Points{
+		length: C.int(len(pts)),
+	}
+	if len(pts) > 0 {
+		cPoints.points = (*C.Point)(&cPointArray[0])
+	}
+	return cPoints
+}
+
+// DrawPolylines draws a polygonal curve through the points to target image.
+// The last point is connected to the first one when isClosed is true.
+func DrawPolylines(img MatVec3b, pts []Point, isClosed bool, color Color,
+	thickness int) {
+	C.DrawPolylines(img.p, toCPoints(pts), boolToCInt(isClosed), color.toC(),
+		C.int(thickness))
+}
+
+// FillPoly fills the area bounded by the polygon of the points.
+func FillPoly(img MatVec3b, pts []Point, color Color) {
+	C.FillPoly(img.p, toCPoints(pts), color.toC())
+}
+
 // LoadAlphaImage loads RGBA type image.
 func LoadAlphaImage(name string) MatVec4b {
 	cName := C.CString(name)
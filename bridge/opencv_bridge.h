@@ -23,14 +23,51 @@ typedef struct Rects {
   Rect* rects;
   int length;
 } Rects;
+typedef struct Point {
+  int x;
+  int y;
+} Point;
+typedef struct Points {
+  Point* points;
+  int length;
+} Points;
+typedef struct Color {
+  int b;
+  int g;
+  int r;
+} Color;
+typedef struct DetectedObject {
+  Rect rect;
+  int level;
+  double weight;
+} DetectedObject;
+typedef struct DetectedObjects {
+  DetectedObject* objects;
+  int length;
+} DetectedObjects;
+typedef struct DetectParams {
+  double scaleFactor;
+  int minNeighbors;
+  int flags;
+  int minWidth;
+  int minHeight;
+  int maxWidth;
+  int maxHeight;
+  int grayscale;
+  int equalizeHist;
+  double detectScale;
+  Rect roi;
+} DetectParams;
 
 #ifdef __cplusplus
+typedef cv::Mat* Mat;
 typedef cv::Mat_<cv::Vec3b>* MatVec3b;
 typedef cv::Mat_<cv::Vec4b>* MatVec4b;
 typedef cv::VideoCapture* VideoCapture;
 typedef cv::VideoWriter* VideoWriter;
 typedef cv::CascadeClassifier* CascadeClassifier;
 #else
+typedef void* Mat;
 typedef void* MatVec3b;
 typedef void* MatVec4b;
 typedef void* VideoCapture;
@@ -38,24 +75,54 @@ typedef void* VideoWriter;
 typedef void* CascadeClassifier;
 #endif
 
+Mat Mat_New();
+Mat Mat_NewWithData(int rows, int cols, int type, struct ByteArray buf);
+void Mat_Delete(Mat m);
+int Mat_Empty(Mat m);
+int Mat_Rows(Mat m);
+int Mat_Cols(Mat m);
+int Mat_Type(Mat m);
+int Mat_Channels(Mat m);
+struct ByteArray Mat_ToBytes(Mat m);
+Mat Mat_CvtColor(Mat m, int code);
+Mat Mat_ConvertTo(Mat m, int type, double alpha, double beta);
+MatVec3b Mat_ToMatVec3b(Mat m);
+Mat Mat_Resize(Mat m, int width, int height, int interpolation);
+Mat Mat_Region(Mat m, struct Rect rect);
+Mat Mat_CopyMakeBorder(Mat m, int top, int bottom, int left, int right,
+  int borderType);
+Mat Mat_Flip(Mat m, int flipCode);
+Mat Mat_Transpose(Mat m);
+Mat Mat_Rotate(Mat m, double angle, int borderType);
+
 MatVec3b MatVec3b_New();
 struct ByteArray MatVec3b_ToJpegData(MatVec3b m, int quality);
 void MatVec3b_Delete(MatVec3b m);
 void MatVec3b_CopyTo(MatVec3b src, MatVec3b dst);
 int MatVec3b_Empty(MatVec3b m);
+int MatVec3b_Cols(MatVec3b m);
+int MatVec3b_Rows(MatVec3b m);
 struct RawData MatVec3b_ToRawData(MatVec3b m);
 MatVec3b RawData_ToMatVec3b(struct RawData r);
+int MatVec3b_Encode(MatVec3b m, const char* ext, int* params, int length,
+  struct ByteArray* buf);
+MatVec3b DecodeToMatVec3b(struct ByteArray buf);
+MatVec4b MatVec3b_ToMatVec4b(MatVec3b m);
+Mat MatVec3b_ToMat(MatVec3b m);
+Mat MatVec3b_ShareMat(MatVec3b m);
 
 void MatVec4b_Delete(MatVec4b m);
 struct RawData MatVec4b_ToRawData(MatVec4b m);
 MatVec4b RawData_ToMatVec4b(struct RawData r);
+MatVec3b MatVec4b_ToMatVec3b(MatVec4b m);
 
 VideoCapture VideoCapture_New();
 void VideoCapture_Delete(VideoCapture v);
 int VideoCapture_Open(VideoCapture v, const char* uri);
 int VideoCapture_OpenDevice(VideoCapture v, int device);
 void VideoCapture_Release(VideoCapture v);
-void VideoCapture_Set(VideoCapture v, int prop, int param);
+int VideoCapture_Set(VideoCapture v, int prop, double param);
+double VideoCapture_Get(VideoCapture v, int prop);
 int VideoCapture_IsOpened(VideoCapture v);
 int VideoCapture_Read(VideoCapture v, MatVec3b buf);
 void VideoCapture_Grab(VideoCapture v, int skip);
@@ -66,15 +133,34 @@ void VideoWriter_Open(VideoWriter vw, const char* name, double fps, int width,
   int height);
 void VideoWriter_OpenWithMat(VideoWriter vw, const char* name, double fps,
   MatVec3b img);
+void VideoWriter_OpenWithCodec(VideoWriter vw, const char* name, int fourcc,
+  double fps, int width, int height);
+void VideoWriter_Release(VideoWriter vw);
 int VideoWriter_IsOpened(VideoWriter vw);
 void VideoWriter_Write(VideoWriter vw, MatVec3b img);
 
 CascadeClassifier CascadeClassifier_New();
 void CascadeClassifier_Delete(CascadeClassifier cs);
 int CascadeClassifier_Load(CascadeClassifier cs, const char* name);
-struct Rects CascadeClassifier_DetectMultiScale(CascadeClassifier cs, MatVec3b img);
+struct Rects CascadeClassifier_DetectMultiScale(CascadeClassifier cs, MatVec3b img,
+  struct DetectParams params);
+struct DetectedObjects CascadeClassifier_DetectMultiScaleWithLevels(
+  CascadeClassifier cs, MatVec3b img, struct DetectParams params);
 void Rects_Delete(struct Rects rs);
+void DetectedObjects_Delete(struct DetectedObjects os);
 void DrawRectsToImage(MatVec3b img, struct Rects rects);
+void DrawRect(MatVec3b img, struct Rect rect, struct Color color, int thickness);
+void DrawLabel(MatVec3b img, struct Rect rect, const char* label, double fontScale,
+  struct Color color, int thickness);
+void DrawText(MatVec3b img, const char* text, struct Point org, double fontScale,
+  struct Color color, int thickness);
+void DrawLine(MatVec3b img, struct Point pt1, struct Point pt2, struct Color color,
+  int thickness);
+void DrawCircle(MatVec3b img, struct Point center, int radius, struct Color color,
+  int thickness);
+void DrawPolylines(MatVec3b img, struct Points pts, int isClosed, struct Color color,
+  int thickness);
+void FillPoly(MatVec3b img, struct Points pts, struct Color color);
 MatVec4b LoadAlphaImg(const char* name);
 void MountAlphaImage(MatVec4b img, MatVec3b back, struct Rects rects);
 
@@ -0,0 +1,346 @@
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	jpegQualityPath = data.MustCompilePath("jpeg_quality")
+	transformsPath  = data.MustCompilePath("transforms")
+)
+
+// toFormatFunc returns a function which converts a captured frame to a map
+// of the output format. Format specific parameters and "transforms" applied
+// to frames before the conversion are read from params.
+func toFormatFunc(format string, params data.Map) (
+	func(m *bridge.MatVec3b) (data.Map, error), error) {
+	f := GetTypeImageFormat(format)
+	formatFunc, err := toEncodeFunc(f, format, params)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := params.Get(transformsPath)
+	if err != nil {
+		return formatFunc, nil
+	}
+	t, err := toTransforms(ts)
+	if err != nil {
+		return nil, err
+	}
+	return withTransform(f, t, formatFunc), nil
+}
+
+// withTransform returns a function which applies the transform to a captured
+// frame before converting it. Raw frames are emitted in the format of the
+// transformed image, e.g. "cvmat_gray" after grayscale, and encoded frames
+// are converted to BGR before encoding.
+func withTransform(f TypeImageFormat, t matTransform,
+	formatFunc func(m *bridge.MatVec3b) (data.Map, error)) func(
+	m *bridge.MatVec3b) (data.Map, error) {
+	return func(m *bridge.MatVec3b) (data.Map, error) {
+		// transforms return new Mats without modifying the input, so the
+		// frame doesn't need to be copied
+		mat := m.ShareMat()
+		defer mat.Delete()
+		ret, err := t(mat)
+		if err != nil {
+			return nil, err
+		}
+		defer ret.Delete()
+
+		if f == TypeCVMAT {
+			raw, err := ToRawDataFromMat(ret)
+			if err != nil {
+				return nil, err
+			}
+			return raw.ConvertToDataMap(), nil
+		}
+		bgr, ok := ret.ToMatVec3b()
+		if !ok {
+			return nil, fmt.Errorf("transformed frame cannot convert to 'MatVec3b'")
+		}
+		defer bgr.Delete()
+		return formatFunc(&bgr)
+	}
+}
+
+// toEncodeFunc returns a function which converts a captured frame to a map
+// of the output format without transforms.
+func toEncodeFunc(f TypeImageFormat, format string, params data.Map) (
+	func(m *bridge.MatVec3b) (data.Map, error), error) {
+	switch f {
+	case TypeCVMAT:
+		return toRawMap, nil
+	case TypeJPEG, TypePNG, TypeWebP, TypeBMP:
+		quality := int64(-1) // default of OpenCV
+		if f == TypeJPEG {
+			quality = 95
+			if q, err := params.Get(jpegQualityPath); err == nil {
+				if quality, err = data.AsInt(q); err != nil {
+					return nil, err
+				}
+				if quality < 0 || quality > 100 {
+					return nil, fmt.Errorf("jpeg quality must be in [0, 100]: %v",
+						quality)
+				}
+			}
+		}
+		// check the format is supported by OpenCV build
+		probe := bridge.ToMatVec3b(1, 1, []byte{0, 0, 0})
+		defer probe.Delete()
+		if _, err := encodeMatVec3b(probe, f, int(quality)); err != nil {
+			return nil, fmt.Errorf("'%v' format is not supported: %v", format,
+				err)
+		}
+		return func(m *bridge.MatVec3b) (data.Map, error) {
+			return toEncodedMap(m, f, int(quality))
+		}, nil
+	default:
+		return nil, fmt.Errorf("'%v' format is not supported", format)
+	}
+}
+
+// captureProperties maps names used in BQL to OpenCV capture properties.
+var captureProperties = map[string]int{
+	"pos_msec":             bridge.CvCapPropPosMsec,
+	"pos_frames":           bridge.CvCapPropPosFrames,
+	"pos_avi_ratio":        bridge.CvCapPropPosAviRatio,
+	"frame_width":          bridge.CvCapPropFrameWidth,
+	"frame_height":         bridge.CvCapPropFrameHeight,
+	"fps":                  bridge.CvCapPropFps,
+	"fourcc":               bridge.CvCapPropFourcc,
+	"frame_count":          bridge.CvCapPropFrameCount,
+	"format":               bridge.CvCapPropFormat,
+	"mode":                 bridge.CvCapPropMode,
+	"brightness":           bridge.CvCapPropBrightness,
+	"contrast":             bridge.CvCapPropContrast,
+	"saturation":           bridge.CvCapPropSaturation,
+	"hue":                  bridge.CvCapPropHue,
+	"gain":                 bridge.CvCapPropGain,
+	"exposure":             bridge.CvCapPropExposure,
+	"convert_rgb":          bridge.CvCapPropConvertRGB,
+	"white_balance_blue_u": bridge.CvCapPropWhiteBalanceBlueU,
+	"rectification":        bridge.CvCapPropRectification,
+	"monochrome":           bridge.CvCapPropMonochrome,
+	"sharpness":            bridge.CvCapPropSharpness,
+	"auto_exposure":        bridge.CvCapPropAutoExposure,
+	"gamma":                bridge.CvCapPropGamma,
+	"temperature":          bridge.CvCapPropTemperature,
+	"trigger":              bridge.CvCapPropTrigger,
+	"trigger_delay":        bridge.CvCapPropTriggerDelay,
+	"white_balance_red_v":  bridge.CvCapPropWhiteBalanceRedV,
+	"zoom":                 bridge.CvCapPropZoom,
+	"focus":                bridge.CvCapPropFocus,
+	"guid":                 bridge.CvCapPropGUID,
+	"iso_speed":            bridge.CvCapPropIsoSpeed,
+	"backlight":            bridge.CvCapPropBacklight,
+	"pan":                  bridge.CvCapPropPan,
+	"tilt":                 bridge.CvCapPropTilt,
+	"roll":                 bridge.CvCapPropRoll,
+	"iris":                 bridge.CvCapPropIris,
+	"settings":             bridge.CvCapPropSettings,
+	"buffersize":           bridge.CvCapPropBuffersize,
+	"autofocus":            bridge.CvCapPropAutofocus,
+}
+
+// captureProperty is a capture property to be set to a video capture.
+type captureProperty struct {
+	name  string
+	prop  int
+	value float64
+}
+
+// toCaptureProperties converts a map of property names and values to capture
+// properties sorted by name.
+func toCaptureProperties(m data.Map) ([]captureProperty, error) {
+	props := make([]captureProperty, 0, len(m))
+	for name, v := range m {
+		prop, ok := captureProperties[name]
+		if !ok {
+			return nil, fmt.Errorf("'%v' capture property is not supported", name)
+		}
+		value, err := data.ToFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, captureProperty{
+			name:  name,
+			prop:  prop,
+			value: value,
+		})
+	}
+	sort.Sort(capturePropertiesByName(props))
+	return props, nil
+}
+
+type capturePropertiesByName []captureProperty
+
+func (p capturePropertiesByName) Len() int           { return len(p) }
+func (p capturePropertiesByName) Less(i, j int) bool { return p[i].name < p[j].name }
+func (p capturePropertiesByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// setCaptureProperties sets properties to the video capture and verifies the
+// values. It returns an error when a property is not supported by the
+// backend, and logs a warning when the backend adjusts the value.
+func setCaptureProperties(ctx *core.Context, vcap *bridge.VideoCapture,
+	props []captureProperty) error {
+	for _, p := range props {
+		if !vcap.Set(p.prop, p.value) {
+			return fmt.Errorf("cannot set capture property '%v' to %v",
+				p.name, p.value)
+		}
+		if actual := vcap.Get(p.prop); propertyAdjusted(p.value, actual) {
+			ctx.Log().Warnf("capture property '%v' is set to %v instead of %v",
+				p.name, actual, p.value)
+		}
+	}
+	return nil
+}
+
+// propertyAdjusted returns true when the actual value of a capture property
+// differs from the expected value beyond rounding errors of the backend.
+func propertyAdjusted(expected, actual float64) bool {
+	return math.Abs(actual-expected) > 1e-6*math.Max(1, math.Abs(expected))
+}
+
+// defaultStopTimeout is the time to wait for a capture loop to release its
+// video capture after stop is requested.
+const defaultStopTimeout = 5 * time.Second
+
+// captureStopper notifies capture loops of a stop request and waits for the
+// loops to release their video capture.
+type captureStopper struct {
+	timeout time.Duration
+
+	mu      sync.Mutex
+	stopped bool
+	stopCh  chan struct{}
+	done    chan struct{}
+}
+
+func newCaptureStopper() *captureStopper {
+	return &captureStopper{
+		timeout: defaultStopTimeout,
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// begin is called when a capture loop starts, and returns a channel which is
+// closed when stop is requested. The returned flag is false when the stopper
+// has already been stopped.
+func (s *captureStopper) begin() (<-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return nil, false
+	}
+	s.done = make(chan struct{})
+	return s.stopCh, true
+}
+
+// end is called when a capture loop released its video capture.
+func (s *captureStopper) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+}
+
+// request notifies the running capture loop of stop without blocking, and
+// returns a function which waits for the loop to release its video capture.
+// The function returns an error when the loop does not finish in time.
+func (s *captureStopper) request() func() error {
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.stopCh)
+	}
+	done := s.done
+	s.mu.Unlock()
+
+	return func() error {
+		if done == nil {
+			return nil
+		}
+		select {
+		case <-done:
+			return nil
+		case <-time.After(s.timeout):
+			return fmt.Errorf("capture did not stop in %v", s.timeout)
+		}
+	}
+}
+
+// stop requests the running capture loop to stop, and waits for the loop to
+// release its video capture. It returns an error when the loop does not
+// finish in time.
+func (s *captureStopper) stop() error {
+	return s.request()()
+}
+
+// captureSource is a capture source which can be requested to stop without
+// waiting for its capture loop.
+type captureSource interface {
+	core.Source
+
+	// requestStop notifies the capture loop of stop, and returns a function
+	// which waits for the loop to release its video capture.
+	requestStop() func() error
+}
+
+// stoppableCapture notifies the capture loop of stop before calling Stop of
+// the source wrapped by core.ImplementSourceStop, which unblocks the loop
+// paused in writing and waits for GenerateStream to return. The wrapped Stop
+// is always called even when the loop does not release its video capture in
+// time.
+type stoppableCapture struct {
+	core.Source
+	capture captureSource
+}
+
+func newStoppableCapture(cs captureSource) core.Source {
+	return &stoppableCapture{
+		Source:  core.ImplementSourceStop(cs),
+		capture: cs,
+	}
+}
+
+func (s *stoppableCapture) Stop(ctx *core.Context) error {
+	wait := s.capture.requestStop()
+	err := s.Source.Stop(ctx)
+	if werr := wait(); err == nil {
+		err = werr
+	}
+	return err
+}
+
+// rewindableCapture is a rewindable version of stoppableCapture.
+type rewindableCapture struct {
+	core.RewindableSource
+	capture captureSource
+}
+
+func newRewindableCapture(cs captureSource) core.Source {
+	return &rewindableCapture{
+		RewindableSource: core.NewRewindableSource(cs),
+		capture:          cs,
+	}
+}
+
+func (s *rewindableCapture) Stop(ctx *core.Context) error {
+	wait := s.capture.requestStop()
+	err := s.RewindableSource.Stop(ctx)
+	if werr := wait(); err == nil {
+		err = werr
+	}
+	return err
+}
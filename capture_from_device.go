@@ -17,6 +17,8 @@ var (
 	widthPath    = data.MustCompilePath("width")
 	heightPath   = data.MustCompilePath("height")
 	fpsPath      = data.MustCompilePath("fps")
+
+	propertiesPath = data.MustCompilePath("properties")
 )
 
 // CreateSource creates a frame generator using OpenCV video capture
@@ -26,13 +28,30 @@ var (
 //
 // device_id: [required] The ID of associated device.
 //
-// format: Output format style, default is "cvmat".
+// format: Output format style, "cvmat", "jpeg", "png", "webp" or "bmp".
+// Default is "cvmat". "webp" is available when OpenCV is built with libwebp.
+//
+// jpeg_quality: The quality of JPEG from 0 to 100 when "format" is "jpeg",
+// default is 95.
+//
+// transforms: An array of transforms applied to each frame in order before
+// the output, e.g. [{"type": "resize", "width": 640}, {"type": "grayscale"}].
+// "type" is one of "resize", "rotate", "flip", "crop", "transpose" and
+// "grayscale", and the other keys are the same parameters as the UDFs, e.g.
+// "angle" of "rotate" and "x", "y", "width" and "height" of "crop". When
+// "format" is "cvmat", grayscale frames are emitted as "cvmat_gray".
 //
 // width: Frame width, if set empty or "0" then will be ignore.
 //
 // height: Frame height, if set empty or "0" then will be ignore.
 //
 // fps: Frame per second, if set empty or "0" then will be ignore.
+//
+// properties: A map of OpenCV capture properties which are set after the
+// device is opened, e.g. {"brightness": 0.5, "autofocus": 0}. Keys are
+// property names in lower snake case of `CV_CAP_PROP_*` (e.g. "exposure" for
+// `CV_CAP_PROP_EXPOSURE`). An error occurs when the device does not support
+// the property.
 func (c *FromDeviceCreator) CreateSource(ctx *core.Context, ioParams *bql.IOParams,
 	params data.Map) (core.Source, error) {
 	cs, err := c.createCaptureFromDevice(ctx, ioParams, params)
@@ -41,12 +60,13 @@ func (c *FromDeviceCreator) CreateSource(ctx *core.Context, ioParams *bql.IOPara
 	}
 
 	// Use ImplementSourceStop helper that can enable this source to stop
-	// thread-safe.
-	return core.ImplementSourceStop(cs), nil
+	// thread-safe. The capture loop is notified of stop before the helper
+	// waits for it.
+	return newStoppableCapture(cs), nil
 }
 
 func (c *FromDeviceCreator) createCaptureFromDevice(ctx *core.Context,
-	ioParams *bql.IOParams, params data.Map) (core.Source, error) {
+	ioParams *bql.IOParams, params data.Map) (captureSource, error) {
 	did, err := params.Get(deviceIDPath)
 	if err != nil {
 		return nil, err
@@ -90,16 +110,27 @@ func (c *FromDeviceCreator) createCaptureFromDevice(ctx *core.Context,
 		return nil, err
 	}
 
-	cs := &captureFromDevice{
-		deviceID: deviceID,
-		width:    width,
-		height:   height,
-		fps:      fps,
+	var props []captureProperty
+	if ps, err := params.Get(propertiesPath); err == nil {
+		psMap, err := data.AsMap(ps)
+		if err != nil {
+			return nil, err
+		}
+		if props, err = toCaptureProperties(psMap); err != nil {
+			return nil, err
+		}
 	}
-	if format == "cvmat" {
-		cs.formatFunc = toRawMap
-	} else {
-		return nil, fmt.Errorf("'%v' format is not supported", format)
+
+	cs := &captureFromDevice{
+		deviceID:   deviceID,
+		width:      width,
+		height:     height,
+		fps:        fps,
+		properties: props,
+		stopper:    newCaptureStopper(),
+	}
+	if cs.formatFunc, err = toFormatFunc(format, params); err != nil {
+		return nil, err
 	}
 	return cs, nil
 }
@@ -109,7 +140,9 @@ type captureFromDevice struct {
 	width      int64
 	height     int64
 	fps        int64
-	formatFunc func(m *bridge.MatVec3b) data.Map
+	properties []captureProperty
+	formatFunc func(m *bridge.MatVec3b) (data.Map, error)
+	stopper    *captureStopper
 }
 
 // GenerateStream streams video capture data. OpenCV parameters
@@ -119,14 +152,24 @@ type captureFromDevice struct {
 //
 // format: The frame's format style, ex) "cvmat", "jpeg",...
 //
-// mode: The frame's format mode, ex) "BGR", "RGBA",...
+// mode: The frame's color mode, ex) "BGR", "RGBA",... It is only given to
+// raw formats such as "cvmat", encoded frames are always decoded as "BGR".
 //
 // width: The frame's width.
 //
 // height: The frame's height.
 //
 // image: The binary data of frame image.
+//
+// When the source is stopped, the video capture is released and this method
+// returns without error.
 func (c *captureFromDevice) GenerateStream(ctx *core.Context, w core.Writer) error {
+	stop, ok := c.stopper.begin()
+	if !ok {
+		return nil
+	}
+	defer c.stopper.end()
+
 	vcap := bridge.NewVideoCapture()
 	defer vcap.Delete()
 
@@ -136,13 +179,16 @@ func (c *captureFromDevice) GenerateStream(ctx *core.Context, w core.Writer) err
 
 	// OpenCV video capture configuration
 	if c.width > 0 {
-		vcap.Set(bridge.CvCapPropFrameWidth, int(c.width))
+		vcap.Set(bridge.CvCapPropFrameWidth, float64(c.width))
 	}
 	if c.height > 0 {
-		vcap.Set(bridge.CvCapPropFrameHeight, int(c.height))
+		vcap.Set(bridge.CvCapPropFrameHeight, float64(c.height))
 	}
 	if c.fps > 0 {
-		vcap.Set(bridge.CvCapPropFps, int(c.fps))
+		vcap.Set(bridge.CvCapPropFps, float64(c.fps))
+	}
+	if err := setCaptureProperties(ctx, &vcap, c.properties); err != nil {
+		return err
 	}
 
 	// streaming, capture from vcap
@@ -150,6 +196,14 @@ func (c *captureFromDevice) GenerateStream(ctx *core.Context, w core.Writer) err
 	defer buf.Delete()
 	ctx.Log().Infof("start reading camera device: %v", c.deviceID)
 	for {
+		select {
+		case <-stop:
+			ctx.Log().Infof("stop reading camera device: %v", c.deviceID)
+			vcap.Release()
+			return nil
+		default:
+		}
+
 		if ok := vcap.Read(buf); !ok {
 			return fmt.Errorf("cannot read a new file (device no: %d)", c.deviceID)
 		}
@@ -158,7 +212,10 @@ func (c *captureFromDevice) GenerateStream(ctx *core.Context, w core.Writer) err
 		}
 
 		now := time.Now()
-		m := c.formatFunc(&buf)
+		m, err := c.formatFunc(&buf)
+		if err != nil {
+			return err
+		}
 		t := core.Tuple{
 			Data:          m,
 			Timestamp:     now,
@@ -172,6 +229,12 @@ func (c *captureFromDevice) GenerateStream(ctx *core.Context, w core.Writer) err
 	return nil
 }
 
+// Stop requests GenerateStream to stop and waits for the video capture to be
+// released. An error is returned when the capture is not released in time.
 func (c *captureFromDevice) Stop(ctx *core.Context) error {
-	return nil
+	return c.stopper.stop()
+}
+
+func (c *captureFromDevice) requestStop() func() error {
+	return c.stopper.request()
 }
@@ -3,6 +3,7 @@ package opencv
 import (
 	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
 	"gopkg.in/sensorbee/sensorbee.v0/bql"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
@@ -55,6 +56,42 @@ func TestGetDeviceSourceCreator(t *testing.T) {
 			})
 		})
 
+		Convey("When create source with capture properties", func() {
+			params := data.Map{
+				"device_id": data.Int(0),
+				"properties": data.Map{
+					"exposure":   data.Float(-4.5),
+					"autofocus":  data.Int(0),
+					"brightness": data.Float(0.5),
+				},
+			}
+			Convey("Then creator should initialize properties sorted by name", func() {
+				s, err := sc.createCaptureFromDevice(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+				capture, ok := s.(*captureFromDevice)
+				So(ok, ShouldBeTrue)
+				So(capture.properties, ShouldResemble, []captureProperty{
+					{name: "autofocus", prop: bridge.CvCapPropAutofocus, value: 0},
+					{name: "brightness", prop: bridge.CvCapPropBrightness, value: 0.5},
+					{name: "exposure", prop: bridge.CvCapPropExposure, value: -4.5},
+				})
+			})
+		})
+
+		Convey("When create source with unknown capture property", func() {
+			params := data.Map{
+				"device_id": data.Int(0),
+				"properties": data.Map{
+					"sparkle": data.Int(1),
+				},
+			}
+			Convey("Then creator should occur an error", func() {
+				s, err := sc.createCaptureFromDevice(ctx, ioParams, params)
+				So(err, ShouldNotBeNil)
+				So(s, ShouldBeNil)
+			})
+		})
+
 		Convey("When create source with empty device ID", func() {
 			params := data.Map{
 				"width":  data.Int(500),
@@ -81,6 +118,7 @@ func TestGetDeviceSourceCreator(t *testing.T) {
 				So(capture.width, ShouldEqual, 0)
 				So(capture.height, ShouldEqual, 0)
 				So(capture.fps, ShouldEqual, 0)
+				So(capture.properties, ShouldBeEmpty)
 			})
 		})
 
@@ -100,10 +138,12 @@ func TestGetDeviceSourceCreator(t *testing.T) {
 				"device_id": data.Int(0),
 			}
 			testMap := data.Map{
-				"format": data.False,
-				"width":  data.String("a"),
-				"height": data.String("b"),
-				"fps":    data.String("@"),
+				"format":     data.False,
+				"width":      data.String("a"),
+				"height":     data.String("b"),
+				"fps":        data.String("@"),
+				"properties": data.Map{"gain": data.String("high")},
+				"transforms": data.Array{data.Map{"type": data.String("shear")}},
 			}
 			for k, v := range testMap {
 				v := v
@@ -125,6 +165,44 @@ func TestGetDeviceSourceCreatorWithRawMode(t *testing.T) {
 	ioParams := &bql.IOParams{}
 	Convey("Given a raw mode enabled capture source creator", t, func() {
 		sc := FromDeviceCreator{}
+		Convey("When create source with JPEG format", func() {
+			params := data.Map{
+				"device_id":    data.Int(0),
+				"format":       data.String("jpeg"),
+				"jpeg_quality": data.Int(80),
+			}
+			s, err := sc.createCaptureFromDevice(ctx, ioParams, params)
+			Convey("Then capture should be created", func() {
+				So(err, ShouldBeNil)
+				capture, ok := s.(*captureFromDevice)
+				So(ok, ShouldBeTrue)
+				So(capture.formatFunc, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When create source with lossless formats", func() {
+			for _, f := range []string{"png", "bmp"} {
+				params := data.Map{
+					"device_id": data.Int(0),
+					"format":    data.String(f),
+				}
+				_, err := sc.createCaptureFromDevice(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+			}
+		})
+
+		Convey("When create source with invalid JPEG quality", func() {
+			for _, q := range []data.Value{data.Int(101), data.Int(-1), data.String("high")} {
+				params := data.Map{
+					"device_id":    data.Int(0),
+					"format":       data.String("jpeg"),
+					"jpeg_quality": q,
+				}
+				_, err := sc.createCaptureFromDevice(ctx, ioParams, params)
+				So(err, ShouldNotBeNil)
+			}
+		})
+
 		Convey("When create source with not supported format", func() {
 			params := data.Map{
 				"device_id": data.Int(0),
@@ -6,6 +6,7 @@ import (
 	"gopkg.in/sensorbee/sensorbee.v0/bql"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"net/url"
 	"time"
 )
 
@@ -18,6 +19,23 @@ var (
 	frameSkipPath      = data.MustCompilePath("frame_skip")
 	nextFrameErrorPath = data.MustCompilePath("next_frame_error")
 	rewindPath         = data.MustCompilePath("rewind")
+
+	reconnectPath           = data.MustCompilePath("reconnect")
+	reconnectIntervalPath   = data.MustCompilePath("reconnect_interval")
+	maxReconnectBackoffPath = data.MustCompilePath("max_reconnect_backoff")
+	maxRetriesPath          = data.MustCompilePath("max_retries")
+
+	timestampPath = data.MustCompilePath("timestamp")
+	baseTimePath  = data.MustCompilePath("base_time")
+
+	realtimePath      = data.MustCompilePath("realtime")
+	playbackSpeedPath = data.MustCompilePath("playback_speed")
+
+	loopPath       = data.MustCompilePath("loop")
+	startFramePath = data.MustCompilePath("start_frame")
+	endFramePath   = data.MustCompilePath("end_frame")
+	startMsecPath  = data.MustCompilePath("start_msec")
+	endMsecPath    = data.MustCompilePath("end_msec")
 )
 
 // CreateSource creates a frame generator using OpenCV video capture.
@@ -27,7 +45,18 @@ var (
 //
 // uri: [required] A capture data's URI (e.g. /data/test.avi).
 //
-// format: Output format style, default is "cvmat".
+// format: Output format style, "cvmat", "jpeg", "png", "webp" or "bmp".
+// Default is "cvmat". "webp" is available when OpenCV is built with libwebp.
+//
+// jpeg_quality: The quality of JPEG from 0 to 100 when "format" is "jpeg",
+// default is 95.
+//
+// transforms: An array of transforms applied to each frame in order before
+// the output, e.g. [{"type": "resize", "width": 640}, {"type": "grayscale"}].
+// "type" is one of "resize", "rotate", "flip", "crop", "transpose" and
+// "grayscale", and the other keys are the same parameters as the UDFs, e.g.
+// "angle" of "rotate" and "x", "y", "width" and "height" of "crop". When
+// "format" is "cvmat", grayscale frames are emitted as "cvmat_gray".
 //
 // frame_skip: The number of frame skip, if set empty or "0" then read all
 // frames. FPS is depended on the URI's file (or device).
@@ -37,6 +66,52 @@ var (
 // value is true.
 //
 // rewind: If set `true` then user can use `REWIND SOURCE` query.
+//
+// reconnect: If set `true` then this source closes and reopens the URI when
+// it cannot read a new frame, e.g. a network camera is disconnected. Default
+// value is false. It is applied only to network streams whose URI has a
+// scheme such as "rtsp://" or "http://", and ignored for files, which end
+// normally. The following reconnection parameters are read only when it is
+// set `true`.
+//
+// reconnect_interval: The interval of the first reconnection in seconds,
+// default is 1. The interval is doubled every failure of reconnection.
+//
+// max_reconnect_backoff: The maximum interval of reconnection in seconds,
+// default is 30.
+//
+// max_retries: The number of reconnection attempts before giving up, if set
+// empty or "0" then retry without limit. When giving up, this source behaves
+// following "next_frame_error".
+//
+// timestamp: The source of tuples' timestamp, "wallclock" or "media". Default
+// value is "wallclock", which is the time of capturing a new frame. "media"
+// is the frame's position in the file added to "base_time".
+//
+// base_time: The base time of "media" timestamp, default is the time when
+// the source starts reading.
+//
+// realtime: If set `true` then this source emits frames at the file's native
+// FPS instead of as fast as frames are read. Default value is false.
+//
+// playback_speed: The multiplier of the FPS on "realtime" mode, e.g. 2 means
+// double speed and 0.5 means half speed. Default value is 1. An error occurs
+// when it is set without "realtime" mode.
+//
+// loop: If set `true` then this source seeks to the start and continues
+// reading when it reaches the end of the file or the range. Default value is
+// false.
+//
+// start_frame: The index of the first frame to read, default is 0.
+//
+// end_frame: The index of the frame to end reading, the frame is not read. If
+// set empty or "0" then read until the end of the file.
+//
+// start_msec: The position in milliseconds to start reading, cannot be set
+// with "start_frame".
+//
+// end_msec: The position in milliseconds to end reading, cannot be set with
+// "end_frame".
 func (c *FromURICreator) CreateSource(ctx *core.Context,
 	ioParams *bql.IOParams, params data.Map) (core.Source, error) {
 
@@ -52,15 +127,16 @@ func (c *FromURICreator) CreateSource(ctx *core.Context,
 		}
 	}
 	// Use Rewindable and ImplementSourceStop helpers that can enable this
-	// source to stop thread-safe.
+	// source to stop thread-safe. The capture loop is notified of stop before
+	// the helpers wait for it.
 	if rewindFlag {
-		return core.NewRewindableSource(cs), nil
+		return newRewindableCapture(cs), nil
 	}
-	return core.ImplementSourceStop(cs), nil
+	return newStoppableCapture(cs), nil
 }
 
 func (c *FromURICreator) createCaptureFromURI(ctx *core.Context,
-	ioParams *bql.IOParams, params data.Map) (core.Source, error) {
+	ioParams *bql.IOParams, params data.Map) (captureSource, error) {
 
 	uri, err := params.Get(uriPath)
 	if err != nil {
@@ -96,24 +172,182 @@ func (c *FromURICreator) createCaptureFromURI(ctx *core.Context,
 		return nil, err
 	}
 
+	reconnect := false
+	if rc, err := params.Get(reconnectPath); err == nil {
+		if reconnect, err = data.AsBool(rc); err != nil {
+			return nil, err
+		}
+	}
+
+	reconnectInterval := 1.0
+	maxBackoff := 30.0
+	maxRetries := int64(0)
+	if reconnect {
+		if ri, err := params.Get(reconnectIntervalPath); err == nil {
+			if reconnectInterval, err = data.ToFloat(ri); err != nil {
+				return nil, err
+			}
+		}
+		if mb, err := params.Get(maxReconnectBackoffPath); err == nil {
+			if maxBackoff, err = data.ToFloat(mb); err != nil {
+				return nil, err
+			}
+		}
+		if reconnectInterval <= 0 || maxBackoff < reconnectInterval {
+			return nil, fmt.Errorf(
+				"reconnect interval must be in (0, %v]: %v", maxBackoff,
+				reconnectInterval)
+		}
+		if mr, err := params.Get(maxRetriesPath); err == nil {
+			if maxRetries, err = data.AsInt(mr); err != nil {
+				return nil, err
+			}
+		}
+		// the end of a file is not a disconnection
+		reconnect = isStreamURI(uriStr)
+	}
+
+	mediaTimestamp := false
+	if ts, err := params.Get(timestampPath); err == nil {
+		tsStr, err := data.AsString(ts)
+		if err != nil {
+			return nil, err
+		}
+		switch tsStr {
+		case "wallclock":
+		case "media":
+			mediaTimestamp = true
+		default:
+			return nil, fmt.Errorf("'%v' timestamp is not supported", tsStr)
+		}
+	}
+
+	var baseTime time.Time
+	if bt, err := params.Get(baseTimePath); err == nil {
+		if baseTime, err = data.ToTimestamp(bt); err != nil {
+			return nil, err
+		}
+	}
+
+	realtime := false
+	if rt, err := params.Get(realtimePath); err == nil {
+		if realtime, err = data.AsBool(rt); err != nil {
+			return nil, err
+		}
+	}
+
+	playbackSpeed := 1.0
+	if ps, err := params.Get(playbackSpeedPath); err == nil {
+		if playbackSpeed, err = data.ToFloat(ps); err != nil {
+			return nil, err
+		}
+		if playbackSpeed <= 0 {
+			return nil, fmt.Errorf("playback speed must be greater than 0: %v",
+				playbackSpeed)
+		}
+		if !realtime {
+			return nil, fmt.Errorf("playback_speed requires realtime mode")
+		}
+	}
+
+	loop := false
+	if lp, err := params.Get(loopPath); err == nil {
+		if loop, err = data.AsBool(lp); err != nil {
+			return nil, err
+		}
+	}
+
+	startFrame, endFrame := int64(0), int64(0)
+	startMsec, endMsec := 0.0, 0.0
+	if sf, err := params.Get(startFramePath); err == nil {
+		if startFrame, err = data.AsInt(sf); err != nil {
+			return nil, err
+		}
+	}
+	if ef, err := params.Get(endFramePath); err == nil {
+		if endFrame, err = data.AsInt(ef); err != nil {
+			return nil, err
+		}
+	}
+	if sm, err := params.Get(startMsecPath); err == nil {
+		if startMsec, err = data.ToFloat(sm); err != nil {
+			return nil, err
+		}
+	}
+	if em, err := params.Get(endMsecPath); err == nil {
+		if endMsec, err = data.ToFloat(em); err != nil {
+			return nil, err
+		}
+	}
+	if startFrame < 0 || endFrame < 0 || startMsec < 0 || endMsec < 0 {
+		return nil, fmt.Errorf("start and end of the range must not be negative")
+	}
+	if startFrame > 0 && startMsec > 0 {
+		return nil, fmt.Errorf("start_frame and start_msec cannot be set together")
+	}
+	if endFrame > 0 && endMsec > 0 {
+		return nil, fmt.Errorf("end_frame and end_msec cannot be set together")
+	}
+	if (endFrame > 0 && endFrame <= startFrame) ||
+		(endMsec > 0 && endMsec <= startMsec) {
+		return nil, fmt.Errorf("the end of the range must be after the start")
+	}
+
 	cs := &captureFromURI{
-		uri:        uriStr,
-		frameSkip:  frameSkip,
-		endErrFlag: endErr,
+		uri:               uriStr,
+		frameSkip:         frameSkip,
+		endErrFlag:        endErr,
+		reconnect:         reconnect,
+		reconnectInterval: time.Duration(reconnectInterval * float64(time.Second)),
+		maxBackoff:        time.Duration(maxBackoff * float64(time.Second)),
+		maxRetries:        maxRetries,
+		mediaTimestamp:    mediaTimestamp,
+		baseTime:          baseTime,
+		realtime:          realtime,
+		playbackSpeed:     playbackSpeed,
+		loop:              loop,
+		startFrame:        startFrame,
+		endFrame:          endFrame,
+		startMsec:         startMsec,
+		endMsec:           endMsec,
+		stopper:           newCaptureStopper(),
 	}
-	if format == "cvmat" {
-		cs.foramtFunc = toRawMap
-	} else {
-		return nil, fmt.Errorf("'%v' format is not supported", format)
+	if cs.foramtFunc, err = toFormatFunc(format, params); err != nil {
+		return nil, err
 	}
 	return cs, nil
 }
 
+// isStreamURI returns true when the URI is a network stream, e.g.
+// "rtsp://camera/stream", rather than a file path.
+func isStreamURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	// a single letter scheme is a drive letter of Windows
+	return len(u.Scheme) > 1 && u.Scheme != "file"
+}
+
 type captureFromURI struct {
-	uri        string
-	frameSkip  int64
-	endErrFlag bool
-	foramtFunc func(m *bridge.MatVec3b) data.Map
+	uri               string
+	frameSkip         int64
+	endErrFlag        bool
+	reconnect         bool
+	reconnectInterval time.Duration
+	maxBackoff        time.Duration
+	maxRetries        int64
+	mediaTimestamp    bool
+	baseTime          time.Time
+	realtime          bool
+	playbackSpeed     float64
+	loop              bool
+	startFrame        int64
+	endFrame          int64
+	startMsec         float64
+	endMsec           float64
+	foramtFunc        func(m *bridge.MatVec3b) (data.Map, error)
+	stopper           *captureStopper
 }
 
 // GenerateStream streams video capture data. OpenCV video capture read frames
@@ -124,7 +358,8 @@ type captureFromURI struct {
 //
 // format: The frame's format style, ex) "cvmat", "jpeg",...
 //
-// mode: The frame's format mode, ex) "BGR", "RGBA",...
+// mode: The frame's color mode, ex) "BGR", "RGBA",... It is only given to
+// raw formats such as "cvmat", encoded frames are always decoded as "BGR".
 //
 // width: The frame's width.
 //
@@ -132,43 +367,153 @@ type captureFromURI struct {
 //
 // image: The binary data of frame image.
 //
+// frame_index: The 0-based index of the frame in the file.
+//
+// pos_msec: The position of the frame in the file in milliseconds.
+//
+// loop_count: The 0-based count of loops which the frame is read in.
+//
 // When a capture source is a file-style (e.g. AVI file), tuples' timestamp is
 // NOT correspond with the file created time. The timestamp value is the time
-// of this source capturing a new frame.
+// of this source capturing a new frame, unless "timestamp" is set "media".
 // And when complete to read the file's all frames, video capture cannot read a
 // new frame. If the key "next_frame_error" set `false` then a no new frame
 // error will not be occurred, User can also count the number of total frame to
 // confirm complete of read file. The number of frames is logged.
+//
+// When "loop" is enabled, this source seeks to the start of the range instead
+// of ending the stream. Media timestamp keeps increasing over loops.
+//
+// When "realtime" is enabled, frames are emitted following their index and
+// the file's FPS multiplied by "playback_speed".
+//
+// When "reconnect" is enabled, this source reopens the URI instead of ending
+// the stream, and each attempt is logged.
+//
+// When the source is stopped, the video capture is released and this method
+// returns without error.
 func (c *captureFromURI) GenerateStream(ctx *core.Context, w core.Writer) error {
+	stop, ok := c.stopper.begin()
+	if !ok {
+		return nil
+	}
+	defer c.stopper.end()
+
 	vcap := bridge.NewVideoCapture()
 	defer vcap.Delete()
 	if ok := vcap.Open(c.uri); !ok {
 		return fmt.Errorf("error opening video stream or file: %v", c.uri)
 	}
+	if (c.startFrame > 0 || c.startMsec > 0) && !c.seekStart(&vcap) {
+		return fmt.Errorf("cannot seek the start of video stream or file: %v",
+			c.uri)
+	}
 
 	buf := bridge.NewMatVec3b()
 	defer buf.Delete()
 
+	baseTime := c.baseTime
+	if baseTime.IsZero() {
+		baseTime = time.Now()
+	}
+
+	fps := vcap.Get(bridge.CvCapPropFps)
+	var pacer *playbackPacer
+	if c.realtime {
+		if fps > 0 {
+			pacer = newPlaybackPacer(fps * c.playbackSpeed)
+		} else {
+			ctx.Log().Warnf("cannot get FPS of %v, realtime mode is disabled",
+				c.uri)
+		}
+	}
+
+	// The states of looping playback. Media timestamp keeps increasing over
+	// loops by adding the duration of previous loops to the base time.
+	loopCount := int64(0)
+	loopFrameCnt := 0
+	firstPosMsec, lastPosMsec := 0.0, 0.0
+	restartLoop := func() bool {
+		if !c.loop || loopFrameCnt == 0 || !c.seekStart(&vcap) {
+			return false
+		}
+		d := lastPosMsec - firstPosMsec
+		if fps > 0 {
+			d += 1000 / fps
+		}
+		baseTime = baseTime.Add(time.Duration(d * float64(time.Millisecond)))
+		loopCount++
+		loopFrameCnt = 0
+		return true
+	}
+
+	backoff := c.newReconnectBackoff()
 	cnt := 0
 	ctx.Log().Infof("start reading video stream of file: %v", c.uri)
 	for {
-		cnt++
+		select {
+		case <-stop:
+			ctx.Log().Infof("stop reading video stream of file: %v", c.uri)
+			vcap.Release()
+			return nil
+		default:
+		}
+
 		if ok := vcap.Read(buf); !ok {
-			ctx.Log().Infof("total read frames count is %d", cnt-1)
+			if restartLoop() {
+				continue
+			}
+			if c.reconnect && c.reconnectStream(ctx, &vcap, stop, &backoff) {
+				continue
+			}
+			ctx.Log().Infof("total read frames count is %d", cnt)
 			if c.endErrFlag {
 				return fmt.Errorf("cannot reed a new frame")
 			}
 			break
 		}
+		if backoff.attempts > 0 {
+			backoff = c.newReconnectBackoff()
+		}
+		// POS_FRAMES is the index of the next frame, so get properties before
+		// skipping frames.
+		frameIndex := int64(vcap.Get(bridge.CvCapPropPosFrames)) - 1
+		posMsec := vcap.Get(bridge.CvCapPropPosMsec)
+		if c.pastEnd(frameIndex, posMsec) {
+			if restartLoop() {
+				continue
+			}
+			ctx.Log().Infof("total read frames count is %d", cnt)
+			break
+		}
 		if c.frameSkip > 0 {
 			vcap.Grab(int(c.frameSkip))
 		}
+		if pacer != nil && !pacer.wait(frameIndex, stop) {
+			continue // stop is handled at the top of the loop
+		}
+		cnt++
+		if loopFrameCnt == 0 {
+			firstPosMsec = posMsec
+		}
+		loopFrameCnt++
+		lastPosMsec = posMsec
 
 		now := time.Now()
-		m := c.foramtFunc(&buf)
+		m, err := c.foramtFunc(&buf)
+		if err != nil {
+			return err
+		}
+		m["frame_index"] = data.Int(frameIndex)
+		m["pos_msec"] = data.Float(posMsec)
+		m["loop_count"] = data.Int(loopCount)
+		ts := now
+		if c.mediaTimestamp {
+			ts = baseTime.Add(time.Duration(posMsec * float64(time.Millisecond)))
+		}
 		t := core.Tuple{
 			Data:          m,
-			Timestamp:     now,
+			Timestamp:     ts,
 			ProcTimestamp: now,
 			Trace:         []core.TraceEvent{},
 		}
@@ -179,6 +524,123 @@ func (c *captureFromURI) GenerateStream(ctx *core.Context, w core.Writer) error
 	return nil
 }
 
+// seekStart seeks the video capture to "start_frame" or "start_msec". When
+// the capture cannot seek, e.g. a network stream, it is reopened.
+func (c *captureFromURI) seekStart(vcap *bridge.VideoCapture) bool {
+	prop, pos := bridge.CvCapPropPosFrames, float64(c.startFrame)
+	if c.startMsec > 0 {
+		prop, pos = bridge.CvCapPropPosMsec, c.startMsec
+	}
+	if vcap.Set(prop, pos) {
+		return true
+	}
+	vcap.Release()
+	if !vcap.Open(c.uri) {
+		return false
+	}
+	return pos == 0 || vcap.Set(prop, pos)
+}
+
+// pastEnd returns true when the frame is out of the range set by "end_frame"
+// or "end_msec".
+func (c *captureFromURI) pastEnd(frameIndex int64, posMsec float64) bool {
+	if c.endFrame > 0 && frameIndex >= c.endFrame {
+		return true
+	}
+	if c.endMsec > 0 && posMsec >= c.endMsec {
+		return true
+	}
+	return false
+}
+
+// playbackPacer waits until the time when a frame should be emitted on
+// realtime playback.
+type playbackPacer struct {
+	interval   time.Duration
+	start      time.Time
+	firstIndex int64
+	lastIndex  int64
+}
+
+func newPlaybackPacer(fps float64) *playbackPacer {
+	return &playbackPacer{
+		interval:  time.Duration(float64(time.Second) / fps),
+		lastIndex: -1,
+	}
+}
+
+// wait blocks until the frame's time. It returns false when stop is
+// requested while waiting.
+func (p *playbackPacer) wait(frameIndex int64, stop <-chan struct{}) bool {
+	// The first frame, or the stream is restarted (e.g. reconnected).
+	if p.lastIndex < 0 || frameIndex <= p.lastIndex {
+		p.start = time.Now()
+		p.firstIndex = frameIndex
+	}
+	p.lastIndex = frameIndex
+
+	next := p.start.Add(time.Duration(frameIndex-p.firstIndex) * p.interval)
+	d := next.Sub(time.Now())
+	if d <= 0 {
+		return true
+	}
+	select {
+	case <-stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// reconnectBackoff is the state of reconnection, which is kept over
+// reconnections until a new frame is read. A stream which is reopened but
+// never delivers a frame also backs off and reaches max_retries.
+type reconnectBackoff struct {
+	attempts int64
+	interval time.Duration
+}
+
+func (c *captureFromURI) newReconnectBackoff() reconnectBackoff {
+	return reconnectBackoff{interval: c.reconnectInterval}
+}
+
+// reconnectStream closes and reopens the video capture with exponential
+// backoff. It returns false when the number of attempts since the last frame
+// exceeds max_retries. When stop is requested while waiting, it returns true
+// and the stop is handled by the caller's loop.
+func (c *captureFromURI) reconnectStream(ctx *core.Context,
+	vcap *bridge.VideoCapture, stop <-chan struct{}, b *reconnectBackoff) bool {
+	for c.maxRetries <= 0 || b.attempts < c.maxRetries {
+		b.attempts++
+		ctx.Log().Infof("reconnecting to video stream %v in %v (attempt %d)",
+			c.uri, b.interval, b.attempts)
+		select {
+		case <-stop:
+			return true
+		case <-time.After(b.interval):
+		}
+
+		vcap.Release()
+		opened := vcap.Open(c.uri)
+		if b.interval *= 2; b.interval > c.maxBackoff {
+			b.interval = c.maxBackoff
+		}
+		if opened {
+			ctx.Log().Infof("reconnected to video stream: %v", c.uri)
+			return true
+		}
+	}
+	ctx.Log().Errorf("gave up reconnecting to video stream %v after %d attempts",
+		c.uri, c.maxRetries)
+	return false
+}
+
+// Stop requests GenerateStream to stop and waits for the video capture to be
+// released. An error is returned when the capture is not released in time.
 func (c *captureFromURI) Stop(ctx *core.Context) error {
-	return nil
+	return c.stopper.stop()
+}
+
+func (c *captureFromURI) requestStop() func() error {
+	return c.stopper.request()
 }
@@ -1,12 +1,21 @@
 package opencv
 
 import (
+	"bytes"
 	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
 	"gopkg.in/sensorbee/sensorbee.v0/bql"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestGenerateStreamURIError(t *testing.T) {
@@ -36,6 +45,234 @@ func (w *dummyWriter) Write(ctx *core.Context, t *core.Tuple) error {
 	return nil
 }
 
+// slowWriter counts written tuples and notifies when the count reaches
+// notifyCount, then writes slowly to keep the source streaming.
+type slowWriter struct {
+	mu          sync.Mutex
+	cnt         int
+	notifyCount int
+	notify      chan struct{}
+}
+
+func newSlowWriter(notifyCount int) *slowWriter {
+	return &slowWriter{
+		notifyCount: notifyCount,
+		notify:      make(chan struct{}),
+	}
+}
+
+func (w *slowWriter) Write(ctx *core.Context, t *core.Tuple) error {
+	w.mu.Lock()
+	w.cnt++
+	if w.cnt == w.notifyCount {
+		close(w.notify)
+	}
+	w.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	return nil
+}
+
+func (w *slowWriter) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cnt
+}
+
+// blockingWriter blocks the first write until release is closed.
+type blockingWriter struct {
+	mu      sync.Mutex
+	cnt     int
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{
+		blocked: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+}
+
+func (w *blockingWriter) Write(ctx *core.Context, t *core.Tuple) error {
+	w.mu.Lock()
+	w.cnt++
+	first := w.cnt == 1
+	w.mu.Unlock()
+	if first {
+		close(w.blocked)
+	}
+	<-w.release
+	return nil
+}
+
+func (w *blockingWriter) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cnt
+}
+
+// tupleCollector stores all written tuples.
+type tupleCollector struct {
+	mu     sync.Mutex
+	tuples []*core.Tuple
+}
+
+func (w *tupleCollector) Write(ctx *core.Context, t *core.Tuple) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.tuples = append(w.tuples, t)
+	return nil
+}
+
+// limitedCollector stores written tuples and returns an error when the
+// number of tuples reaches the limit.
+type limitedCollector struct {
+	tupleCollector
+	limit int
+}
+
+func (w *limitedCollector) Write(ctx *core.Context, t *core.Tuple) error {
+	w.tupleCollector.Write(ctx, t)
+	if len(w.tuples) >= w.limit {
+		return fmt.Errorf("reached the limit")
+	}
+	return nil
+}
+
+// createTestVideo writes a synthetic video file which has the number of
+// frames.
+func createTestVideo(fileName string, frames int) {
+	vw := bridge.NewVideoWriter()
+	defer vw.Delete()
+	vw.Open(fileName, 30, 64, 48)
+	So(vw.IsOpened(), ShouldBeTrue)
+	for i := 0; i < frames; i++ {
+		raw := RawData{
+			Format: TypeCVMAT,
+			Width:  64,
+			Height: 48,
+			Data:   make([]byte, 64*48*3),
+		}
+		for j := range raw.Data {
+			raw.Data[j] = byte(i)
+		}
+		mat, err := raw.ToMatVec3b()
+		So(err, ShouldBeNil)
+		vw.Write(mat)
+		mat.Delete()
+	}
+	vw.Release()
+}
+
+func TestStopCaptureFromURI(t *testing.T) {
+	ctx := core.NewContext(nil)
+	ioParams := &bql.IOParams{}
+	Convey("Given a synthetic video file", t, func() {
+		fileName := "_test_capture_stop.avi"
+		createTestVideo(fileName, 200)
+		Reset(func() {
+			os.Remove(fileName)
+		})
+		params := data.Map{
+			"uri":              data.String(fileName),
+			"next_frame_error": data.False,
+		}
+
+		Convey("When stop a capture source mid-stream", func() {
+			sc := FromURICreator{}
+			s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			w := newSlowWriter(10)
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, w)
+			}()
+			<-w.notify
+			err = s.Stop(ctx)
+
+			Convey("Then the source should stop cleanly before reading all frames", func() {
+				So(err, ShouldBeNil)
+				So(<-ch, ShouldBeNil)
+				So(w.count(), ShouldBeLessThan, 200)
+			})
+		})
+
+		for _, rewind := range []bool{false, true} {
+			rewind := rewind
+			msg := fmt.Sprintf("with rewind=%v", rewind)
+			Convey("When stop a capture source created by the creator "+msg, func() {
+				params["rewind"] = data.Bool(rewind)
+				sc := FromURICreator{}
+				s, err := sc.CreateSource(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+				w := newSlowWriter(10)
+				ch := make(chan error, 1)
+				go func() {
+					ch <- s.GenerateStream(ctx, w)
+				}()
+				<-w.notify
+				err = s.Stop(ctx)
+
+				Convey("Then the source should stop before reading all frames", func() {
+					So(err, ShouldBeNil)
+					<-ch
+					So(w.count(), ShouldBeLessThan, 200)
+				})
+			})
+		}
+
+		Convey("When stop a paused capture source", func() {
+			params["rewind"] = data.True
+			sc := FromURICreator{}
+			s, err := sc.CreateSource(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			r, ok := s.(core.Resumable)
+			So(ok, ShouldBeTrue)
+			w := newSlowWriter(10)
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, w)
+			}()
+			<-w.notify
+			So(r.Pause(ctx), ShouldBeNil)
+			start := time.Now()
+			err = s.Stop(ctx)
+
+			Convey("Then the source should stop promptly", func() {
+				So(err, ShouldBeNil)
+				So(time.Since(start), ShouldBeLessThan, time.Second)
+				<-ch
+			})
+		})
+
+		Convey("When stop a capture source blocked in writing", func() {
+			sc := FromURICreator{}
+			s, err := sc.CreateSource(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			w := newBlockingWriter()
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, w)
+			}()
+			<-w.blocked
+			stopped := make(chan error, 1)
+			start := time.Now()
+			go func() {
+				stopped <- s.Stop(ctx)
+			}()
+			time.Sleep(100 * time.Millisecond)
+			close(w.release)
+
+			Convey("Then the source should stop promptly after the write returns", func() {
+				So(<-stopped, ShouldBeNil)
+				So(time.Since(start), ShouldBeLessThan, time.Second)
+				<-ch
+				So(w.count(), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
 func TestGetURISourceCreatorWithRawMode(t *testing.T) {
 	ctx := &core.Context{}
 	ioParams := &bql.IOParams{}
@@ -77,6 +314,188 @@ func TestGetURISourceCreator(t *testing.T) {
 			})
 		})
 
+		Convey("When create source with reconnect parameters", func() {
+			params := data.Map{
+				"uri":                   data.String("http://localhost/stream"),
+				"reconnect":             data.True,
+				"reconnect_interval":    data.Float(0.5),
+				"max_reconnect_backoff": data.Int(10),
+				"max_retries":           data.Int(5),
+			}
+			Convey("Then creator should initialize reconnect settings", func() {
+				s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+				capture, ok := s.(*captureFromURI)
+				So(ok, ShouldBeTrue)
+				So(capture.reconnect, ShouldBeTrue)
+				So(capture.reconnectInterval, ShouldEqual, 500*time.Millisecond)
+				So(capture.maxBackoff, ShouldEqual, 10*time.Second)
+				So(capture.maxRetries, ShouldEqual, 5)
+			})
+		})
+
+		Convey("When create source with invalid reconnect parameters", func() {
+			testMap := data.Map{
+				"reconnect_interval":    data.String("a"),
+				"max_reconnect_backoff": data.String("b"),
+				"max_retries":           data.String("c"),
+			}
+			for k, v := range testMap {
+				k, v := k, v
+				params := data.Map{
+					"uri": data.String("http://localhost/stream"),
+					k:     v,
+				}
+				Convey("Then creator should occur an error with "+k+" when reconnect is enabled",
+					func() {
+						params["reconnect"] = data.True
+						s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+						So(err, ShouldNotBeNil)
+						So(s, ShouldBeNil)
+					})
+				Convey("Then creator should ignore "+k+" when reconnect is disabled",
+					func() {
+						s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+						So(err, ShouldBeNil)
+						capture, ok := s.(*captureFromURI)
+						So(ok, ShouldBeTrue)
+						So(capture.reconnect, ShouldBeFalse)
+					})
+			}
+		})
+
+		Convey("When create source of a file with reconnect", func() {
+			params := data.Map{
+				"uri":       data.String("/data/file.avi"),
+				"reconnect": data.True,
+			}
+			Convey("Then reconnect should be disabled", func() {
+				s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+				capture, ok := s.(*captureFromURI)
+				So(ok, ShouldBeTrue)
+				So(capture.reconnect, ShouldBeFalse)
+			})
+		})
+
+		Convey("When create source with reconnect interval longer than max backoff", func() {
+			params := data.Map{
+				"uri":                   data.String("http://localhost/stream"),
+				"reconnect":             data.True,
+				"reconnect_interval":    data.Int(10),
+				"max_reconnect_backoff": data.Int(5),
+			}
+			Convey("Then creator should occur an error", func() {
+				s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+				So(err, ShouldNotBeNil)
+				So(s, ShouldBeNil)
+			})
+		})
+
+		Convey("When create source with media timestamp", func() {
+			base := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+			params := data.Map{
+				"uri":       data.String("/data/file.avi"),
+				"timestamp": data.String("media"),
+				"base_time": data.Timestamp(base),
+			}
+			Convey("Then creator should initialize timestamp settings", func() {
+				s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+				capture, ok := s.(*captureFromURI)
+				So(ok, ShouldBeTrue)
+				So(capture.mediaTimestamp, ShouldBeTrue)
+				So(capture.baseTime, ShouldResemble, base)
+			})
+		})
+
+		Convey("When create source with realtime playback", func() {
+			params := data.Map{
+				"uri":            data.String("/data/file.avi"),
+				"realtime":       data.True,
+				"playback_speed": data.Float(0.5),
+			}
+			Convey("Then creator should initialize playback settings", func() {
+				s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+				capture, ok := s.(*captureFromURI)
+				So(ok, ShouldBeTrue)
+				So(capture.realtime, ShouldBeTrue)
+				So(capture.playbackSpeed, ShouldEqual, 0.5)
+			})
+		})
+
+		Convey("When create source with zero playback speed", func() {
+			params := data.Map{
+				"uri":            data.String("/data/file.avi"),
+				"realtime":       data.True,
+				"playback_speed": data.Int(0),
+			}
+			Convey("Then creator should occur an error", func() {
+				s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+				So(err, ShouldNotBeNil)
+				So(s, ShouldBeNil)
+			})
+		})
+
+		Convey("When create source with playback speed without realtime", func() {
+			params := data.Map{
+				"uri":            data.String("/data/file.avi"),
+				"playback_speed": data.Float(2),
+			}
+			Convey("Then creator should occur an error", func() {
+				s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+				So(err, ShouldNotBeNil)
+				So(s, ShouldBeNil)
+				params["realtime"] = data.False
+				s, err = sc.createCaptureFromURI(ctx, ioParams, params)
+				So(err, ShouldNotBeNil)
+				So(s, ShouldBeNil)
+			})
+		})
+
+		Convey("When create source with looping playback of a range", func() {
+			params := data.Map{
+				"uri":        data.String("/data/file.avi"),
+				"loop":       data.True,
+				"start_msec": data.Int(1000),
+				"end_msec":   data.Float(2500.5),
+			}
+			Convey("Then creator should initialize the range", func() {
+				s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+				capture, ok := s.(*captureFromURI)
+				So(ok, ShouldBeTrue)
+				So(capture.loop, ShouldBeTrue)
+				So(capture.startMsec, ShouldEqual, 1000)
+				So(capture.endMsec, ShouldEqual, 2500.5)
+			})
+		})
+
+		Convey("When create source with invalid ranges", func() {
+			ranges := []data.Map{
+				{"start_frame": data.Int(10), "start_msec": data.Int(10)},
+				{"end_frame": data.Int(10), "end_msec": data.Int(10)},
+				{"start_frame": data.Int(10), "end_frame": data.Int(5)},
+				{"start_msec": data.Int(10), "end_msec": data.Int(10)},
+				{"start_frame": data.Int(-1)},
+			}
+			for i, r := range ranges {
+				r := r
+				Convey(fmt.Sprintf("Then creator should occur an error with range %d", i), func() {
+					params := data.Map{
+						"uri": data.String("/data/file.avi"),
+					}
+					for k, v := range r {
+						params[k] = v
+					}
+					s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+					So(err, ShouldNotBeNil)
+					So(s, ShouldBeNil)
+				})
+			}
+		})
+
 		Convey("When create source with empty uri", func() {
 			params := data.Map{
 				"frame_skip":       data.Int(5),
@@ -101,6 +520,19 @@ func TestGetURISourceCreator(t *testing.T) {
 				So(capture.uri, ShouldEqual, "/data/file.avi")
 				So(capture.frameSkip, ShouldEqual, 0)
 				So(capture.endErrFlag, ShouldBeTrue)
+				So(capture.reconnect, ShouldBeFalse)
+				So(capture.reconnectInterval, ShouldEqual, time.Second)
+				So(capture.maxBackoff, ShouldEqual, 30*time.Second)
+				So(capture.maxRetries, ShouldEqual, 0)
+				So(capture.mediaTimestamp, ShouldBeFalse)
+				So(capture.baseTime.IsZero(), ShouldBeTrue)
+				So(capture.realtime, ShouldBeFalse)
+				So(capture.playbackSpeed, ShouldEqual, 1)
+				So(capture.loop, ShouldBeFalse)
+				So(capture.startFrame, ShouldEqual, 0)
+				So(capture.endFrame, ShouldEqual, 0)
+				So(capture.startMsec, ShouldEqual, 0)
+				So(capture.endMsec, ShouldEqual, 0)
 			})
 		})
 
@@ -123,6 +555,16 @@ func TestGetURISourceCreator(t *testing.T) {
 				"format":           data.True,
 				"frame_skip":       data.String("@"),
 				"next_frame_error": data.String("True"),
+				"reconnect":        data.String("True"),
+				"timestamp":        data.String("system"),
+				"base_time":        data.True,
+				"realtime":         data.String("yes"),
+				"playback_speed":   data.String("fast"),
+				"loop":             data.String("forever"),
+				"start_frame":      data.String("a"),
+				"end_frame":        data.String("b"),
+				"start_msec":       data.String("c"),
+				"end_msec":         data.String("d"),
 			}
 			for k, v := range testMap {
 				v := v
@@ -152,3 +594,511 @@ func TestGetURISourceCreator(t *testing.T) {
 		})
 	})
 }
+
+func TestMediaTimestampCaptureFromURI(t *testing.T) {
+	ctx := core.NewContext(nil)
+	ioParams := &bql.IOParams{}
+	Convey("Given a synthetic video file", t, func() {
+		fileName := "_test_capture_timestamp.avi"
+		createTestVideo(fileName, 10)
+		Reset(func() {
+			os.Remove(fileName)
+		})
+
+		Convey("When capture the file with media timestamp", func() {
+			base := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+			params := data.Map{
+				"uri":              data.String(fileName),
+				"next_frame_error": data.False,
+				"timestamp":        data.String("media"),
+				"base_time":        data.Timestamp(base),
+			}
+			sc := FromURICreator{}
+			s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			w := &tupleCollector{}
+			So(s.GenerateStream(ctx, w), ShouldBeNil)
+
+			Convey("Then tuples' timestamp should be the position in the file", func() {
+				So(len(w.tuples), ShouldEqual, 10)
+				for i, t := range w.tuples {
+					So(t.Data["frame_index"], ShouldEqual, data.Int(i))
+					posMsec, err := data.ToFloat(t.Data["pos_msec"])
+					So(err, ShouldBeNil)
+					So(posMsec, ShouldAlmostEqual, float64(i)*1000/30, 1)
+					So(t.Timestamp.Sub(base), ShouldAlmostEqual,
+						time.Duration(posMsec*float64(time.Millisecond)), time.Millisecond)
+				}
+			})
+		})
+
+		Convey("When capture the file with frame skip", func() {
+			params := data.Map{
+				"uri":              data.String(fileName),
+				"next_frame_error": data.False,
+				"frame_skip":       data.Int(1),
+			}
+			sc := FromURICreator{}
+			s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			w := &tupleCollector{}
+			So(s.GenerateStream(ctx, w), ShouldBeNil)
+
+			Convey("Then frame index should skip frames", func() {
+				So(len(w.tuples), ShouldEqual, 5)
+				for i, t := range w.tuples {
+					So(t.Data["frame_index"], ShouldEqual, data.Int(i*2))
+				}
+			})
+		})
+	})
+}
+
+func TestLoopCaptureFromURI(t *testing.T) {
+	ctx := core.NewContext(nil)
+	ioParams := &bql.IOParams{}
+	Convey("Given a synthetic video file", t, func() {
+		fileName := "_test_capture_loop.avi"
+		createTestVideo(fileName, 10)
+		Reset(func() {
+			os.Remove(fileName)
+		})
+
+		Convey("When capture a range of the file with loop", func() {
+			params := data.Map{
+				"uri":         data.String(fileName),
+				"loop":        data.True,
+				"start_frame": data.Int(2),
+				"end_frame":   data.Int(5),
+				"timestamp":   data.String("media"),
+			}
+			sc := FromURICreator{}
+			s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			w := &limitedCollector{limit: 9}
+			So(s.GenerateStream(ctx, w), ShouldNotBeNil)
+
+			Convey("Then the range should be read repeatedly", func() {
+				So(len(w.tuples), ShouldEqual, 9)
+				for i, t := range w.tuples {
+					So(t.Data["frame_index"], ShouldEqual, data.Int(2+i%3))
+					So(t.Data["loop_count"], ShouldEqual, data.Int(i/3))
+					if i > 0 {
+						So(t.Timestamp.After(w.tuples[i-1].Timestamp), ShouldBeTrue)
+					}
+				}
+			})
+		})
+
+		Convey("When capture the whole file with loop", func() {
+			params := data.Map{
+				"uri":  data.String(fileName),
+				"loop": data.True,
+			}
+			sc := FromURICreator{}
+			s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			w := &limitedCollector{limit: 25}
+			So(s.GenerateStream(ctx, w), ShouldNotBeNil)
+
+			Convey("Then the file should be read over the end", func() {
+				So(len(w.tuples), ShouldEqual, 25)
+				So(w.tuples[24].Data["frame_index"], ShouldEqual, data.Int(4))
+				So(w.tuples[24].Data["loop_count"], ShouldEqual, data.Int(2))
+			})
+		})
+
+		Convey("When capture a range of the file without loop", func() {
+			params := data.Map{
+				"uri":         data.String(fileName),
+				"start_frame": data.Int(3),
+				"end_frame":   data.Int(7),
+			}
+			sc := FromURICreator{}
+			s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			w := &tupleCollector{}
+
+			Convey("Then the range should be read once without error", func() {
+				So(s.GenerateStream(ctx, w), ShouldBeNil)
+				So(len(w.tuples), ShouldEqual, 4)
+				for i, t := range w.tuples {
+					So(t.Data["frame_index"], ShouldEqual, data.Int(3+i))
+					So(t.Data["loop_count"], ShouldEqual, data.Int(0))
+				}
+			})
+		})
+	})
+}
+
+func TestJPEGCaptureFromURI(t *testing.T) {
+	ctx := core.NewContext(nil)
+	ioParams := &bql.IOParams{}
+	Convey("Given a synthetic video file", t, func() {
+		fileName := "_test_capture_jpeg.avi"
+		createTestVideo(fileName, 3)
+		Reset(func() {
+			os.Remove(fileName)
+		})
+
+		Convey("When capture the file with JPEG format", func() {
+			params := data.Map{
+				"uri":              data.String(fileName),
+				"next_frame_error": data.False,
+				"format":           data.String("jpeg"),
+				"jpeg_quality":     data.Int(50),
+			}
+			sc := FromURICreator{}
+			s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			w := &tupleCollector{}
+			So(s.GenerateStream(ctx, w), ShouldBeNil)
+
+			Convey("Then frames should be emitted as JPEG", func() {
+				So(len(w.tuples), ShouldEqual, 3)
+				for _, t := range w.tuples {
+					raw, err := ConvertMapToRawData(t.Data)
+					So(err, ShouldBeNil)
+					So(raw.Format, ShouldEqual, TypeJPEG)
+					So(raw.Width, ShouldEqual, 64)
+					So(raw.Height, ShouldEqual, 48)
+					So(len(raw.Data), ShouldBeLessThan, 64*48*3)
+					img, err := jpeg.Decode(bytes.NewReader(raw.Data))
+					So(err, ShouldBeNil)
+					So(img.Bounds().Dx(), ShouldEqual, 64)
+					So(img.Bounds().Dy(), ShouldEqual, 48)
+				}
+			})
+		})
+	})
+}
+
+func TestTransformCaptureFromURI(t *testing.T) {
+	ctx := core.NewContext(nil)
+	ioParams := &bql.IOParams{}
+	Convey("Given a synthetic video file", t, func() {
+		fileName := "_test_capture_transform.avi"
+		createTestVideo(fileName, 3)
+		Reset(func() {
+			os.Remove(fileName)
+		})
+		sc := FromURICreator{}
+		params := data.Map{
+			"uri":              data.String(fileName),
+			"next_frame_error": data.False,
+		}
+
+		Convey("When capture the file with resize and grayscale transforms", func() {
+			params["transforms"] = data.Array{
+				data.Map{"type": data.String("resize"), "scale": data.Float(0.5)},
+				data.Map{"type": data.String("grayscale")},
+			}
+			s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			w := &tupleCollector{}
+			So(s.GenerateStream(ctx, w), ShouldBeNil)
+
+			Convey("Then frames should be emitted as transformed", func() {
+				So(len(w.tuples), ShouldEqual, 3)
+				for _, t := range w.tuples {
+					raw, err := ConvertMapToRawData(t.Data)
+					So(err, ShouldBeNil)
+					So(raw.Format, ShouldEqual, TypeCVMATGray)
+					So(raw.Width, ShouldEqual, 32)
+					So(raw.Height, ShouldEqual, 24)
+					So(len(raw.Data), ShouldEqual, 32*24)
+				}
+			})
+		})
+
+		Convey("When capture the file with crop and rotate transforms in JPEG", func() {
+			params["format"] = data.String("jpeg")
+			params["transforms"] = data.Array{
+				data.Map{"type": data.String("crop"), "x": data.Int(0),
+					"y": data.Int(0), "width": data.Int(40), "height": data.Int(20)},
+				data.Map{"type": data.String("rotate"), "angle": data.Int(90)},
+			}
+			s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			w := &tupleCollector{}
+			So(s.GenerateStream(ctx, w), ShouldBeNil)
+
+			Convey("Then frames should be emitted as transformed JPEG", func() {
+				So(len(w.tuples), ShouldEqual, 3)
+				for _, t := range w.tuples {
+					raw, err := ConvertMapToRawData(t.Data)
+					So(err, ShouldBeNil)
+					So(raw.Format, ShouldEqual, TypeJPEG)
+					img, err := jpeg.Decode(bytes.NewReader(raw.Data))
+					So(err, ShouldBeNil)
+					So(img.Bounds().Dx(), ShouldEqual, 20)
+					So(img.Bounds().Dy(), ShouldEqual, 40)
+				}
+			})
+		})
+
+		Convey("When create source with invalid transforms", func() {
+			testTransforms := []data.Value{
+				data.String("resize"),
+				data.Array{data.String("resize")},
+				data.Array{data.Map{"width": data.Int(32)}},
+				data.Array{data.Map{"type": data.String("shear")}},
+				data.Array{data.Map{"type": data.String("resize")}},
+				data.Array{data.Map{"type": data.String("rotate")}},
+				data.Array{data.Map{"type": data.String("flip"),
+					"mode": data.String("diagonal")}},
+				data.Array{data.Map{"type": data.String("crop"), "x": data.Int(0)}},
+			}
+			Convey("Then creator should occur an error", func() {
+				for _, ts := range testTransforms {
+					params["transforms"] = ts
+					s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+					So(err, ShouldNotBeNil)
+					So(s, ShouldBeNil)
+				}
+			})
+		})
+	})
+}
+
+func TestReconnectCaptureFromFile(t *testing.T) {
+	ctx := core.NewContext(nil)
+	ioParams := &bql.IOParams{}
+	Convey("Given a synthetic video file", t, func() {
+		fileName := "_test_capture_reconnect.avi"
+		createTestVideo(fileName, 3)
+		Reset(func() {
+			os.Remove(fileName)
+		})
+
+		Convey("When capture the file with reconnect", func() {
+			params := data.Map{
+				"uri":                data.String(fileName),
+				"next_frame_error":   data.False,
+				"reconnect":          data.True,
+				"reconnect_interval": data.Float(0.05),
+			}
+			sc := FromURICreator{}
+			s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			w := &tupleCollector{}
+			err = s.GenerateStream(ctx, w)
+
+			Convey("Then the file should be read only once", func() {
+				So(err, ShouldBeNil)
+				So(len(w.tuples), ShouldEqual, 3)
+			})
+		})
+	})
+}
+
+func TestRealtimeCaptureFromURI(t *testing.T) {
+	ctx := core.NewContext(nil)
+	ioParams := &bql.IOParams{}
+	Convey("Given a synthetic video file of 30 fps", t, func() {
+		fileName := "_test_capture_realtime.avi"
+		createTestVideo(fileName, 16)
+		Reset(func() {
+			os.Remove(fileName)
+		})
+
+		for _, speed := range []float64{1, 2, 0.5} {
+			speed := speed
+			Convey(fmt.Sprintf("When capture the file on realtime mode with speed %v", speed), func() {
+				params := data.Map{
+					"uri":              data.String(fileName),
+					"next_frame_error": data.False,
+					"realtime":         data.True,
+					"playback_speed":   data.Float(speed),
+				}
+				sc := FromURICreator{}
+				s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+				w := &tupleCollector{}
+				So(s.GenerateStream(ctx, w), ShouldBeNil)
+
+				Convey("Then frames should be emitted at the file's FPS", func() {
+					So(len(w.tuples), ShouldEqual, 16)
+					elapsed := w.tuples[15].ProcTimestamp.Sub(w.tuples[0].ProcTimestamp)
+					expected := time.Duration(15 * float64(time.Second) / 30 / speed)
+					So(elapsed, ShouldAlmostEqual, expected, 50*time.Millisecond)
+				})
+			})
+		}
+	})
+}
+
+func TestPlaybackPacer(t *testing.T) {
+	Convey("Given a playback pacer of 100 fps", t, func() {
+		p := newPlaybackPacer(100)
+		stop := make(chan struct{})
+
+		Convey("When wait frames", func() {
+			start := time.Now()
+			for i := int64(0); i < 5; i++ {
+				So(p.wait(i, stop), ShouldBeTrue)
+			}
+			Convey("Then waiting should follow the frame interval", func() {
+				So(time.Now().Sub(start), ShouldBeGreaterThanOrEqualTo,
+					40*time.Millisecond)
+			})
+		})
+
+		Convey("When the frame index goes back", func() {
+			So(p.wait(100, stop), ShouldBeTrue)
+			start := time.Now()
+			So(p.wait(0, stop), ShouldBeTrue)
+			Convey("Then the pacer should restart without waiting", func() {
+				So(time.Now().Sub(start), ShouldBeLessThan, 10*time.Millisecond)
+			})
+		})
+
+		Convey("When stop is requested while waiting", func() {
+			So(p.wait(0, stop), ShouldBeTrue)
+			close(stop)
+			Convey("Then wait should return false", func() {
+				So(p.wait(1000, stop), ShouldBeFalse)
+			})
+		})
+	})
+}
+
+// mjpegServer is a stand-in of a network camera streaming MJPEG over HTTP.
+// It streams frames to the first `streams` connections and then refuses
+// connections.
+type mjpegServer struct {
+	mu      sync.Mutex
+	conns   int
+	streams int
+	frames  int
+}
+
+func (m *mjpegServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.conns++
+	conns := m.conns
+	m.mu.Unlock()
+	if conns > m.streams {
+		http.NotFound(w, r)
+		return
+	}
+
+	buf := bytes.NewBuffer(nil)
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+	for i := 0; i < m.frames; i++ {
+		fmt.Fprintf(w, "--frame\r\nContent-Type: image/jpeg\r\n"+
+			"Content-Length: %d\r\n\r\n", buf.Len())
+		w.Write(buf.Bytes())
+		fmt.Fprint(w, "\r\n")
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (m *mjpegServer) connections() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conns
+}
+
+func TestReconnectCaptureFromURI(t *testing.T) {
+	ctx := core.NewContext(nil)
+	ioParams := &bql.IOParams{}
+	Convey("Given a MJPEG stream server which drops connections", t, func() {
+		m := &mjpegServer{
+			streams: 2,
+			frames:  20,
+		}
+		server := httptest.NewServer(m)
+		Reset(func() {
+			server.Close()
+		})
+
+		Convey("When capture the stream with reconnect", func() {
+			params := data.Map{
+				"uri":                data.String(server.URL + "/stream.mjpg"),
+				"next_frame_error":   data.False,
+				"reconnect":          data.True,
+				"reconnect_interval": data.Float(0.05),
+				"max_retries":        data.Int(2),
+			}
+			sc := FromURICreator{}
+			s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			w := newSlowWriter(0)
+			err = s.GenerateStream(ctx, w)
+
+			Convey("Then the source should resume reading frames after reconnection", func() {
+				So(err, ShouldBeNil)
+				So(m.connections(), ShouldBeGreaterThanOrEqualTo, 3)
+				So(w.count(), ShouldBeGreaterThan, m.frames)
+			})
+		})
+
+		Convey("When capture a stream which is reopened but sends no frames", func() {
+			m := &mjpegServer{
+				streams: 100,
+				frames:  0,
+			}
+			server := httptest.NewServer(m)
+			Reset(func() {
+				server.Close()
+			})
+			params := data.Map{
+				"uri":                   data.String(server.URL + "/stream.mjpg"),
+				"next_frame_error":      data.False,
+				"reconnect":             data.True,
+				"reconnect_interval":    data.Float(0.01),
+				"max_reconnect_backoff": data.Float(0.04),
+				"max_retries":           data.Int(3),
+			}
+			sc := FromURICreator{}
+			s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			w := newSlowWriter(0)
+			ch := make(chan error, 1)
+			go func() {
+				ch <- s.GenerateStream(ctx, w)
+			}()
+			Reset(func() {
+				s.Stop(ctx)
+			})
+
+			Convey("Then the source should give up after max_retries", func() {
+				select {
+				case err := <-ch:
+					So(err, ShouldBeNil)
+				case <-time.After(10 * time.Second):
+					So("reconnection did not give up", ShouldBeEmpty)
+				}
+				So(w.count(), ShouldEqual, 0)
+				So(m.connections(), ShouldBeLessThanOrEqualTo, 4)
+			})
+		})
+
+		Convey("When capture the stream without reconnect", func() {
+			params := data.Map{
+				"uri":              data.String(server.URL + "/stream.mjpg"),
+				"next_frame_error": data.False,
+			}
+			sc := FromURICreator{}
+			s, err := sc.createCaptureFromURI(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			w := newSlowWriter(0)
+			err = s.GenerateStream(ctx, w)
+
+			Convey("Then the source should end with the first connection", func() {
+				So(err, ShouldBeNil)
+				So(m.connections(), ShouldEqual, 1)
+				So(w.count(), ShouldBeLessThanOrEqualTo, m.frames)
+			})
+		})
+	})
+}
@@ -0,0 +1,68 @@
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestCaptureStopper(t *testing.T) {
+	Convey("Given a capture stopper", t, func() {
+		s := newCaptureStopper()
+		s.timeout = 100 * time.Millisecond
+
+		Convey("When stop without running capture loop", func() {
+			err := s.stop()
+			Convey("Then stop should succeed", func() {
+				So(err, ShouldBeNil)
+			})
+			Convey("Then a new capture loop should not begin", func() {
+				_, ok := s.begin()
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When stop a running capture loop", func() {
+			stop, ok := s.begin()
+			So(ok, ShouldBeTrue)
+			go func() {
+				<-stop
+				s.end()
+			}()
+			Convey("Then stop should wait the loop and succeed", func() {
+				So(s.stop(), ShouldBeNil)
+				So(s.stop(), ShouldBeNil)
+			})
+		})
+
+		Convey("When stop a capture loop which does not finish", func() {
+			_, ok := s.begin()
+			So(ok, ShouldBeTrue)
+			Reset(func() {
+				s.end()
+			})
+			Convey("Then stop should return an error", func() {
+				So(s.stop(), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestPropertyAdjusted(t *testing.T) {
+	Convey("Given capture property values read back from a backend", t, func() {
+		Convey("When the values differ only by rounding", func() {
+			Convey("Then they should not be adjusted", func() {
+				So(propertyAdjusted(29.97, 29.970000000000002), ShouldBeFalse)
+				So(propertyAdjusted(-4.5, -4.5000001), ShouldBeFalse)
+				So(propertyAdjusted(0, 1e-9), ShouldBeFalse)
+			})
+		})
+		Convey("When the backend changes the values", func() {
+			Convey("Then they should be adjusted", func() {
+				So(propertyAdjusted(29.97, 30), ShouldBeTrue)
+				So(propertyAdjusted(0.5, 0.498), ShouldBeTrue)
+				So(propertyAdjusted(0, 1), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -5,18 +5,71 @@ import (
 	"gopkg.in/sensorbee/opencv.v0/bridge"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"sync"
 )
 
 var (
-	configFilePath = data.MustCompilePath("file")
-	xPath          = data.MustCompilePath("x")
-	yPath          = data.MustCompilePath("y")
+	configFilePath   = data.MustCompilePath("file")
+	xPath            = data.MustCompilePath("x")
+	yPath            = data.MustCompilePath("y")
+	scaleFactorPath  = data.MustCompilePath("scale_factor")
+	minNeighborsPath = data.MustCompilePath("min_neighbors")
+	flagsPath        = data.MustCompilePath("flags")
+	minSizePath      = data.MustCompilePath("min_size")
+	maxSizePath      = data.MustCompilePath("max_size")
+	rejectLevelsPath = data.MustCompilePath("output_reject_levels")
+	grayscalePath    = data.MustCompilePath("grayscale")
+	equalizeHistPath = data.MustCompilePath("equalize_hist")
+	detectScalePath  = data.MustCompilePath("detect_scale")
+	roiPath          = data.MustCompilePath("roi")
+	poolSizePath     = data.MustCompilePath("pool_size")
 )
 
 // NewCascadeClassifier returns cascadeClassifier state.
 //
 // file: cascade configuration file path for detection.
 // e.g. "haarcascade_frontalface_default.xml".
+//
+// scale_factor: How much the image size is reduced at each image scale,
+// default is 1.1. It must be greater than 1.
+//
+// min_neighbors: How many neighbors each candidate rectangle should have to
+// retain it, default is 3.
+//
+// flags: The flags of `cv::CascadeClassifier::detectMultiScale`, e.g. 2 is
+// CASCADE_SCALE_IMAGE. Default is 0.
+//
+// min_size: The minimum object size as a map of "width" and "height". Smaller
+// objects are ignored. Default is no limit.
+//
+// max_size: The maximum object size as a map of "width" and "height". Larger
+// objects are ignored. Default is no limit.
+//
+// output_reject_levels: When true, each detected rectangle has "level" and
+// "weight" fields, which are the reject level and its weight. The weight can
+// be used as the confidence of the detection. Default is false.
+//
+// grayscale: When true, the image is converted to grayscale before the
+// detection, which is faster and usually more accurate because classifiers
+// are trained on grayscale images. Default is false.
+//
+// equalize_hist: When true, the histogram of the grayscale image is
+// equalized before the detection to reduce effects of uneven lighting. The
+// image is converted to grayscale even if "grayscale" is false. Default is
+// false.
+//
+// detect_scale: The scale of the image for the detection in (0, 1], e.g. 0.5
+// detects on the half size image. Detected rectangles, min_size and max_size
+// are in coordinates of the original image. Default is 1.
+//
+// roi: A region of interest as a map of "x", "y", "width" and "height", or an
+// array of them. Only the regions are detected, and detected rectangles are
+// in coordinates of the whole image. Rectangles detected in overlapped
+// regions can be duplicated. Default is the whole image.
+//
+// pool_size: The number of classifier instances loaded from the file. Each
+// detection uses one instance exclusively, so up to pool_size statements can
+// detect with the state concurrently. Default is 1.
 func NewCascadeClassifier(ctx *core.Context, params data.Map) (core.SharedState,
 	error) {
 	var filePath string
@@ -26,22 +79,324 @@ func NewCascadeClassifier(ctx *core.Context, params data.Map) (core.SharedState,
 		return nil, err
 	}
 
-	cc := bridge.NewCascadeClassifier()
-	if !cc.Load(filePath) {
-		return nil, fmt.Errorf("cannot load the file '%v'", filePath)
+	opts, err := toDetectOptions(params, detectOptions{
+		params: bridge.NewDetectParams(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	poolSize := int64(1)
+	if ps, err := params.Get(poolSizePath); err == nil {
+		if poolSize, err = data.AsInt(ps); err != nil {
+			return nil, err
+		}
+		if poolSize <= 0 {
+			return nil, fmt.Errorf("pool_size must be greater than 0: %v",
+				poolSize)
+		}
 	}
 
+	pool, err := newClassifierPool(filePath, int(poolSize))
+	if err != nil {
+		return nil, err
+	}
 	return &cascadeClassifier{
-		classifier: cc,
+		filePath: filePath,
+		pool:     pool,
+		opts:     opts,
 	}, nil
 }
 
+// classifierPool is a pool of classifiers loaded from the same file.
+type classifierPool struct {
+	classifiers chan *bridge.CascadeClassifier
+
+	// users counts detections using the pool.
+	users sync.WaitGroup
+}
+
+// newClassifierPool returns a pool of classifiers loaded from the file. The
+// pool is a buffered channel filled with the classifiers.
+func newClassifierPool(filePath string, size int) (*classifierPool, error) {
+	pool := &classifierPool{
+		classifiers: make(chan *bridge.CascadeClassifier, size),
+	}
+	for i := 0; i < size; i++ {
+		cc := bridge.NewCascadeClassifier()
+		if !cc.Load(filePath) {
+			cc.Delete()
+			pool.delete()
+			return nil, fmt.Errorf("cannot load the file '%v'", filePath)
+		}
+		pool.classifiers <- &cc
+	}
+	return pool, nil
+}
+
+// delete waits for all detections using the pool to finish, and deletes all
+// classifiers in the pool. The pool must not be taken by new detections.
+func (p *classifierPool) delete() {
+	p.users.Wait()
+	for n := len(p.classifiers); n > 0; n-- {
+		cc := <-p.classifiers
+		cc.Delete()
+	}
+}
+
+// detectOptions is options of detection, which are given to a state and can
+// be overridden by each call.
+type detectOptions struct {
+	params             bridge.DetectParams
+	outputRejectLevels bool
+	rois               []bridge.Rect
+}
+
+// toDetectOptions returns detection options which overwrites base by params.
+// Options which are not given in params keep the values of base.
+func toDetectOptions(params data.Map, base detectOptions) (detectOptions,
+	error) {
+	opts := base
+	p, err := toDetectParams(params, base.params)
+	if err != nil {
+		return opts, err
+	}
+	opts.params = p
+	if rl, err := params.Get(rejectLevelsPath); err == nil {
+		if opts.outputRejectLevels, err = data.AsBool(rl); err != nil {
+			return opts, err
+		}
+	}
+	if r, err := params.Get(roiPath); err == nil {
+		if opts.rois, err = toROIs(r); err != nil {
+			return opts, fmt.Errorf("roi is invalid: %v", err)
+		}
+	}
+	return opts, nil
+}
+
+// toROIs converts a rectangle map or an array of them to rectangles.
+func toROIs(v data.Value) ([]bridge.Rect, error) {
+	var rects data.Array
+	if v.Type() == data.TypeMap {
+		rects = data.Array{v}
+	} else {
+		a, err := data.AsArray(v)
+		if err != nil {
+			return nil, err
+		}
+		rects = a
+	}
+	rois, err := convertToBridgeRects(rects)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rois {
+		if r.Width <= 0 || r.Height <= 0 {
+			return nil, fmt.Errorf("size must be greater than 0: %vx%v",
+				r.Width, r.Height)
+		}
+	}
+	return rois, nil
+}
+
+// toDetectParams returns detection parameters which overwrites base by
+// params. Parameters which are not given in params keep the values of base.
+func toDetectParams(params data.Map, base bridge.DetectParams) (
+	bridge.DetectParams, error) {
+	p := base
+	if sf, err := params.Get(scaleFactorPath); err == nil {
+		if p.ScaleFactor, err = data.ToFloat(sf); err != nil {
+			return p, err
+		}
+		if p.ScaleFactor <= 1 {
+			return p, fmt.Errorf("scale_factor must be greater than 1: %v",
+				p.ScaleFactor)
+		}
+	}
+	if mn, err := params.Get(minNeighborsPath); err == nil {
+		n, err := data.AsInt(mn)
+		if err != nil {
+			return p, err
+		}
+		if n < 0 {
+			return p, fmt.Errorf("min_neighbors must not be negative: %v", n)
+		}
+		p.MinNeighbors = int(n)
+	}
+	if fl, err := params.Get(flagsPath); err == nil {
+		f, err := data.AsInt(fl)
+		if err != nil {
+			return p, err
+		}
+		if f < 0 {
+			return p, fmt.Errorf("flags must not be negative: %v", f)
+		}
+		p.Flags = int(f)
+	}
+	if ms, err := params.Get(minSizePath); err == nil {
+		if p.MinWidth, p.MinHeight, err = toDetectSize(ms); err != nil {
+			return p, fmt.Errorf("min_size is invalid: %v", err)
+		}
+	}
+	if ms, err := params.Get(maxSizePath); err == nil {
+		if p.MaxWidth, p.MaxHeight, err = toDetectSize(ms); err != nil {
+			return p, fmt.Errorf("max_size is invalid: %v", err)
+		}
+	}
+	if g, err := params.Get(grayscalePath); err == nil {
+		if p.Grayscale, err = data.AsBool(g); err != nil {
+			return p, err
+		}
+	}
+	if eh, err := params.Get(equalizeHistPath); err == nil {
+		if p.EqualizeHist, err = data.AsBool(eh); err != nil {
+			return p, err
+		}
+	}
+	if ds, err := params.Get(detectScalePath); err == nil {
+		if p.DetectScale, err = data.ToFloat(ds); err != nil {
+			return p, err
+		}
+		if p.DetectScale <= 0 || p.DetectScale > 1 {
+			return p, fmt.Errorf("detect_scale must be in (0, 1]: %v",
+				p.DetectScale)
+		}
+	}
+	return p, nil
+}
+
+func toDetectSize(v data.Value) (int, int, error) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return 0, 0, err
+	}
+	var width, height int64
+	if w, err := m.Get(widthPath); err != nil {
+		return 0, 0, err
+	} else if width, err = data.ToInt(w); err != nil {
+		return 0, 0, err
+	}
+	if h, err := m.Get(heightPath); err != nil {
+		return 0, 0, err
+	} else if height, err = data.ToInt(h); err != nil {
+		return 0, 0, err
+	}
+	if width < 0 || height < 0 {
+		return 0, 0, fmt.Errorf("size must not be negative: %vx%v", width,
+			height)
+	}
+	return int(width), int(height), nil
+}
+
 type cascadeClassifier struct {
-	classifier bridge.CascadeClassifier
+	// mu is locked only to take or replace the pool and options, and is not
+	// held during detection.
+	mu       sync.RWMutex
+	filePath string
+	pool     *classifierPool
+	opts     detectOptions
+
+	// updateMu serializes updates so that concurrent updates don't lose
+	// options of each other.
+	updateMu sync.Mutex
+}
+
+// use calls f with a classifier taken from the pool and detection options of
+// the state. The classifier is used by f exclusively. It blocks until a
+// classifier is returned to the pool when all of them are in use. The pool
+// can be replaced while f is running, and f keeps using the classifier of the
+// old pool.
+func (c *cascadeClassifier) use(f func(cc *bridge.CascadeClassifier,
+	opts detectOptions) error) error {
+	c.mu.RLock()
+	pool, opts := c.pool, c.opts
+	if pool == nil {
+		c.mu.RUnlock()
+		return fmt.Errorf("cascade classifier is already terminated")
+	}
+	pool.users.Add(1)
+	c.mu.RUnlock()
+	defer pool.users.Done()
+
+	cc := <-pool.classifiers
+	defer func() {
+		pool.classifiers <- cc
+	}()
+	return f(cc, opts)
+}
+
+// Update reloads classifiers of the state. It accepts the same parameters as
+// NewCascadeClassifier except pool_size. When "file" is not given, the
+// current file is reloaded. Given detection options overwrite the current
+// options, and the others are kept.
+func (c *cascadeClassifier) Update(ctx *core.Context, params data.Map) error {
+	c.updateMu.Lock()
+	defer c.updateMu.Unlock()
+
+	c.mu.RLock()
+	filePath := c.filePath
+	pool := c.pool
+	opts := c.opts
+	c.mu.RUnlock()
+	if pool == nil {
+		return fmt.Errorf("cascade classifier is already terminated")
+	}
+
+	if fp, err := params.Get(configFilePath); err == nil {
+		if filePath, err = data.AsString(fp); err != nil {
+			return err
+		}
+	}
+	if _, err := params.Get(poolSizePath); err == nil {
+		return fmt.Errorf("pool_size cannot be updated")
+	}
+	opts, err := toDetectOptions(params, opts)
+	if err != nil {
+		return err
+	}
+	return c.reload(filePath, cap(pool.classifiers), opts)
+}
+
+// reload replaces the pool with classifiers loaded from the file. Detections
+// in progress keep using the old classifiers, and following detections use
+// the new ones without waiting for them. The old classifiers are deleted in
+// the background after all detections using them finish. It must be called
+// with updateMu locked.
+func (c *cascadeClassifier) reload(filePath string, size int,
+	opts detectOptions) error {
+	pool, err := newClassifierPool(filePath, size)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	old := c.pool
+	if old != nil {
+		c.filePath = filePath
+		c.pool = pool
+		c.opts = opts
+	}
+	c.mu.Unlock()
+
+	if old == nil {
+		pool.delete()
+		return fmt.Errorf("cascade classifier is already terminated")
+	}
+	go old.delete()
+	return nil
 }
 
+// Terminate deletes the classifiers after all detections in progress finish.
 func (c *cascadeClassifier) Terminate(ctx *core.Context) error {
-	c.classifier.Delete()
+	c.mu.Lock()
+	pool := c.pool
+	c.pool = nil
+	c.mu.Unlock()
+
+	if pool != nil {
+		pool.delete()
+	}
 	return nil
 }
 
@@ -63,9 +418,18 @@ func lookupCascadeClassifier(ctx *core.Context, name string) (*cascadeClassifier
 //
 // classifierName: cascadeClassifier state name.
 //
-// img: target image as RawData map structure.
-func DetectMultiScale(ctx *core.Context, classifierName string, img data.Map) (
-	data.Array, error) {
+// img: target image as RawData map structure. All formats supported by
+// RawData are accepted, e.g. "cvmat", "cvmat4b", "jpeg" and "png".
+//
+// params: An optional map of detection parameters which overrides the
+// parameters of the state for this call, e.g. {"min_neighbors": 5}. The same
+// keys as the state, such as "scale_factor", "min_size",
+// "output_reject_levels" and "roi", are supported.
+func DetectMultiScale(ctx *core.Context, classifierName string, img data.Map,
+	params ...data.Map) (data.Array, error) {
+	if len(params) > 1 {
+		return nil, fmt.Errorf("too many arguments")
+	}
 	raw, err := ConvertMapToRawData(img)
 	if err != nil {
 		return nil, err
@@ -80,48 +444,132 @@ func DetectMultiScale(ctx *core.Context, classifierName string, img data.Map) (
 	if err != nil {
 		return nil, err
 	}
-	rects := classifier.classifier.DetectMultiScale(mat)
-	ret := make(data.Array, len(rects))
-	for i, r := range rects {
-		rect := data.Map{
-			"x":      data.Int(r.X),
-			"y":      data.Int(r.Y),
-			"width":  data.Int(r.Width),
-			"height": data.Int(r.Height),
+	var ret data.Array
+	err = classifier.use(func(cc *bridge.CascadeClassifier,
+		opts detectOptions) error {
+		if len(params) == 1 {
+			var err error
+			if opts, err = toDetectOptions(params[0], opts); err != nil {
+				return err
+			}
+		}
+		if len(opts.rois) == 0 {
+			ret = detectObjects(cc, mat, opts, opts.params)
+			return nil
 		}
-		ret[i] = rect
+		ret = data.Array{}
+		for _, roi := range opts.rois {
+			p := opts.params
+			p.ROI = roi
+			ret = append(ret, detectObjects(cc, mat, opts, p)...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return ret, nil
 }
 
-// DrawRectsToImage draws rectangle information on target image. The image is
-// required to structured as RawData.
-func DrawRectsToImage(img data.Map, rects data.Array) (data.Map, error) {
-	if len(rects) == 0 {
-		return img, nil
-	}
-	raw, err := ConvertMapToRawData(img)
+// ReloadCascadeClassifier reloads the cascade configuration file of the
+// state. Detections in progress finish with the old classifiers, and
+// following detections use the reloaded ones. It returns true on success.
+//
+// classifierName: cascadeClassifier state name.
+func ReloadCascadeClassifier(ctx *core.Context, classifierName string) (bool,
+	error) {
+	classifier, err := lookupCascadeClassifier(ctx, classifierName)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	// copy image binary
-	temp := make([]byte, len(raw.Data))
-	copy(temp, raw.Data)
-	raw.Data = temp
-	mat, err := raw.ToMatVec3b()
+	if err := classifier.Update(ctx, data.Map{}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// detectObjects detects objects with the parameters and returns them as an
+// array of rectangle maps.
+func detectObjects(cc *bridge.CascadeClassifier, mat bridge.MatVec3b,
+	opts detectOptions, p bridge.DetectParams) data.Array {
+	if opts.outputRejectLevels {
+		objects := cc.DetectMultiScaleWithLevels(mat, p)
+		ret := make(data.Array, len(objects))
+		for i, o := range objects {
+			rect := toRectMap(o.Rect)
+			rect["level"] = data.Int(o.Level)
+			rect["weight"] = data.Float(o.Weight)
+			ret[i] = rect
+		}
+		return ret
+	}
+	rects := cc.DetectMultiScaleWithParams(mat, p)
+	ret := make(data.Array, len(rects))
+	for i, r := range rects {
+		ret[i] = toRectMap(r)
+	}
+	return ret
+}
+
+func toRectMap(r bridge.Rect) data.Map {
+	return data.Map{
+		"x":      data.Int(r.X),
+		"y":      data.Int(r.Y),
+		"width":  data.Int(r.Width),
+		"height": data.Int(r.Height),
+	}
+}
+
+// DrawRectsToImage draws rectangle information on target image. The image is
+// required to structured as RawData, and the returned image has the same
+// format and color mode as the target image.
+//
+// rects: An array of rectangle maps which have "x", "y", "width" and
+// "height". Each map can also have style fields which override the style of
+// the call, "color", "thickness", "label" and "font_scale".
+//
+// style: An optional map of the style of all rectangles.
+//
+// color: The color of rectangles and labels as an array of [blue, green,
+// red], default is [0, 200, 0].
+//
+// thickness: The thickness of rectangle lines, default is 3. A negative value
+// fills rectangles.
+//
+// label: The text drawn above the rectangle, e.g. a class name or a score.
+// Numbers are converted to strings. Default is no label.
+//
+// font_scale: The scale of label font, default is 0.5.
+func DrawRectsToImage(img data.Map, rects data.Array, style ...data.Map) (
+	data.Map, error) {
+	baseStyle, err := toOptionalDrawStyle(style, defaultDrawStyle)
 	if err != nil {
 		return nil, err
 	}
-	defer mat.Delete()
-
+	if len(rects) == 0 {
+		return img, nil
+	}
 	brRects, err := convertToBridgeRects(rects)
 	if err != nil {
 		return nil, err
 	}
+	styles := make([]drawStyle, len(rects))
+	for i, r := range rects {
+		rmap, _ := data.AsMap(r) // already checked by convertToBridgeRects
+		if styles[i], err = toDrawStyle(rmap, baseStyle); err != nil {
+			return nil, err
+		}
+	}
 
-	bridge.DrawRectsToImage(mat, brRects)
-	retRaw := ToRawData(mat)
-	return retRaw.ConvertToDataMap(), nil
+	return drawOnImage(img, func(mat bridge.MatVec3b) {
+		for i, r := range brRects {
+			st := styles[i]
+			bridge.DrawRect(mat, r, st.color, st.thickness)
+			if st.label != "" {
+				bridge.DrawLabel(mat, r, st.label, st.fontScale, st.color, 1)
+			}
+		}
+	})
 }
 
 func convertToBridgeRects(rects data.Array) ([]bridge.Rect, error) {
@@ -202,7 +650,8 @@ func lookupSharedImage(ctx *core.Context, name string) (*sharedImage, error) {
 		name)
 }
 
-// MountAlphaImage draw target image on back image.
+// MountAlphaImage draw target image on back image. The returned image has the
+// same format and color mode as the back image.
 func MountAlphaImage(ctx *core.Context, imgName string, back data.Map,
 	rects data.Array) (data.Map, error) {
 	if len(rects) == 0 {
@@ -233,6 +682,9 @@ func MountAlphaImage(ctx *core.Context, imgName string, back data.Map,
 	}
 
 	bridge.MountAlphaImage(img.img, mat, brRects)
-	retRaw := ToRawData(mat)
+	retRaw, err := toRawDataLike(mat, raw)
+	if err != nil {
+		return nil, err
+	}
 	return retRaw.ConvertToDataMap(), nil
 }
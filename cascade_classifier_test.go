@@ -1,35 +1,19 @@
 package opencv
 
 import (
+	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
 	"gopkg.in/sensorbee/sensorbee.v0/core"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
 	"io/ioutil"
 	"os"
+	"sync"
 	"testing"
+	"time"
 )
 
-func TestNewCascadeClassifier(t *testing.T) {
-	Convey("Given a SensorBee's core.Context", t, func() {
-		ctx := &core.Context{}
-		Convey("When create state with empty map", func() {
-			params := data.Map{}
-			_, err := NewCascadeClassifier(ctx, params)
-			Convey("Then should return an error", func() {
-				So(err, ShouldNotBeNil)
-			})
-		})
-		Convey("When create state with not exist file name", func() {
-			params := data.Map{
-				"file": data.String("not_exist_file"),
-			}
-			_, err := NewCascadeClassifier(ctx, params)
-			Convey("Then should return an error", func() {
-				So(err, ShouldNotBeNil)
-			})
-		})
-		Convey("When create state with file name", func() {
-			xml := `<?xml version="1.0"?>
+const testCascadeXML = `<?xml version="1.0"?>
 <opencv_storage>
 <cascade>
   <stageType>BOOST</stageType>
@@ -55,8 +39,33 @@ func TestNewCascadeClassifier(t *testing.T) {
 </cascade>
 </opencv_storage>
 `
-			err := ioutil.WriteFile("_test_for_face_detect.xml", []byte(xml), 0644)
-			So(err, ShouldBeNil)
+
+func createTestCascadeFile(fileName string) {
+	err := ioutil.WriteFile(fileName, []byte(testCascadeXML), 0644)
+	So(err, ShouldBeNil)
+}
+
+func TestNewCascadeClassifier(t *testing.T) {
+	Convey("Given a SensorBee's core.Context", t, func() {
+		ctx := &core.Context{}
+		Convey("When create state with empty map", func() {
+			params := data.Map{}
+			_, err := NewCascadeClassifier(ctx, params)
+			Convey("Then should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When create state with not exist file name", func() {
+			params := data.Map{
+				"file": data.String("not_exist_file"),
+			}
+			_, err := NewCascadeClassifier(ctx, params)
+			Convey("Then should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When create state with file name", func() {
+			createTestCascadeFile("_test_for_face_detect.xml")
 			Reset(func() {
 				os.Remove("_test_for_face_detect.xml")
 			})
@@ -71,7 +80,543 @@ func TestNewCascadeClassifier(t *testing.T) {
 			Convey("Then state should be created", func() {
 				cc, ok := st.(*cascadeClassifier)
 				So(ok, ShouldBeTrue)
-				So(cc.classifier, ShouldNotBeNil)
+				So(len(cc.pool.classifiers), ShouldEqual, 1)
+				So(cc.opts, ShouldResemble, detectOptions{
+					params: bridge.NewDetectParams(),
+				})
+			})
+		})
+		Convey("When create state with detection parameters", func() {
+			createTestCascadeFile("_test_for_face_detect.xml")
+			Reset(func() {
+				os.Remove("_test_for_face_detect.xml")
+			})
+			params := data.Map{
+				"file":          data.String("_test_for_face_detect.xml"),
+				"scale_factor":  data.Float(1.2),
+				"min_neighbors": data.Int(5),
+				"flags":         data.Int(2),
+				"min_size": data.Map{
+					"width":  data.Int(30),
+					"height": data.Int(40),
+				},
+				"max_size": data.Map{
+					"width":  data.Int(300),
+					"height": data.Int(400),
+				},
+				"output_reject_levels": data.True,
+				"grayscale":            data.True,
+				"equalize_hist":        data.True,
+				"detect_scale":         data.Float(0.5),
+			}
+			st, err := NewCascadeClassifier(ctx, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				st.Terminate(ctx)
+			})
+			Convey("Then state should have the parameters", func() {
+				cc, ok := st.(*cascadeClassifier)
+				So(ok, ShouldBeTrue)
+				So(cc.opts.params, ShouldResemble, bridge.DetectParams{
+					ScaleFactor:  1.2,
+					MinNeighbors: 5,
+					Flags:        2,
+					MinWidth:     30,
+					MinHeight:    40,
+					MaxWidth:     300,
+					MaxHeight:    400,
+					Grayscale:    true,
+					EqualizeHist: true,
+					DetectScale:  0.5,
+				})
+				So(cc.opts.outputRejectLevels, ShouldBeTrue)
+			})
+		})
+		Convey("When create state with pool size", func() {
+			createTestCascadeFile("_test_for_face_detect.xml")
+			Reset(func() {
+				os.Remove("_test_for_face_detect.xml")
+			})
+			params := data.Map{
+				"file":      data.String("_test_for_face_detect.xml"),
+				"pool_size": data.Int(4),
+			}
+			st, err := NewCascadeClassifier(ctx, params)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				st.Terminate(ctx)
+			})
+			Convey("Then state should have the classifiers", func() {
+				cc, ok := st.(*cascadeClassifier)
+				So(ok, ShouldBeTrue)
+				So(len(cc.pool.classifiers), ShouldEqual, 4)
+			})
+			Convey("Then the classifiers should be deleted by Terminate", func() {
+				cc, _ := st.(*cascadeClassifier)
+				So(st.Terminate(ctx), ShouldBeNil)
+				So(cc.pool, ShouldBeNil)
+				So(cc.use(func(*bridge.CascadeClassifier, detectOptions) error {
+					return nil
+				}), ShouldNotBeNil)
+			})
+		})
+		Convey("When create state with invalid detection parameters", func() {
+			createTestCascadeFile("_test_for_face_detect.xml")
+			Reset(func() {
+				os.Remove("_test_for_face_detect.xml")
+			})
+			testMap := map[string]data.Value{
+				"scale_factor":         data.Float(1.0),
+				"min_neighbors":        data.Int(-1),
+				"flags":                data.String("a"),
+				"min_size":             data.Map{"width": data.Int(30)},
+				"max_size":             data.Map{"width": data.Int(-1), "height": data.Int(1)},
+				"output_reject_levels": data.String("yes"),
+				"grayscale":            data.Int(1),
+				"equalize_hist":        data.String("true"),
+				"detect_scale":         data.Float(1.5),
+				"pool_size":            data.Int(0),
+			}
+			for k, v := range testMap {
+				k, v := k, v
+				Convey("Then should return an error with "+k, func() {
+					params := data.Map{
+						"file": data.String("_test_for_face_detect.xml"),
+						k:      v,
+					}
+					_, err := NewCascadeClassifier(ctx, params)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestCascadeClassifierConcurrentDetection(t *testing.T) {
+	Convey("Given a cascade classifier state shared by many goroutines", t, func() {
+		ctx := core.NewContext(nil)
+		createTestCascadeFile("_test_for_concurrent_detect.xml")
+		Reset(func() {
+			os.Remove("_test_for_concurrent_detect.xml")
+		})
+		st, err := NewCascadeClassifier(ctx, data.Map{
+			"file":      data.String("_test_for_concurrent_detect.xml"),
+			"pool_size": data.Int(2),
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("test_classifier", "opencv_cascade_classifier",
+			st), ShouldBeNil)
+		Reset(func() {
+			st.Terminate(ctx)
+		})
+		img := testRawData(16, 16).ConvertToDataMap()
+
+		Convey("When detect concurrently", func() {
+			const n = 16
+			errs := make(chan error, n*10)
+			wg := sync.WaitGroup{}
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 10; j++ {
+						_, err := DetectMultiScale(ctx, "test_classifier", img)
+						errs <- err
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			Convey("Then all detections should succeed", func() {
+				for err := range errs {
+					So(err, ShouldBeNil)
+				}
+				cc, _ := st.(*cascadeClassifier)
+				So(len(cc.pool.classifiers), ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestReloadCascadeClassifier(t *testing.T) {
+	Convey("Given a cascade classifier state", t, func() {
+		ctx := core.NewContext(nil)
+		createTestCascadeFile("_test_for_reload.xml")
+		Reset(func() {
+			os.Remove("_test_for_reload.xml")
+		})
+		st, err := NewCascadeClassifier(ctx, data.Map{
+			"file":      data.String("_test_for_reload.xml"),
+			"pool_size": data.Int(2),
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("test_classifier", "opencv_cascade_classifier",
+			st), ShouldBeNil)
+		Reset(func() {
+			st.Terminate(ctx)
+		})
+		cc, _ := st.(*cascadeClassifier)
+		oldPool := cc.pool
+
+		Convey("When reload it by the UDF", func() {
+			ok, err := ReloadCascadeClassifier(ctx, "test_classifier")
+			Convey("Then the pool should be replaced", func() {
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+				So(cc.pool, ShouldNotEqual, oldPool)
+				So(len(cc.pool.classifiers), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When update it with a new file and options", func() {
+			createTestCascadeFile("_test_for_reload2.xml")
+			Reset(func() {
+				os.Remove("_test_for_reload2.xml")
+			})
+			err := cc.Update(ctx, data.Map{
+				"file":          data.String("_test_for_reload2.xml"),
+				"min_neighbors": data.Int(7),
+			})
+			Convey("Then the state should use the new file and options", func() {
+				So(err, ShouldBeNil)
+				So(cc.filePath, ShouldEqual, "_test_for_reload2.xml")
+				So(cc.pool, ShouldNotEqual, oldPool)
+				So(cc.opts.params.MinNeighbors, ShouldEqual, 7)
+				So(cc.opts.params.ScaleFactor, ShouldEqual, 1.1)
+			})
+		})
+
+		Convey("When update it with invalid parameters", func() {
+			Convey("Then the state should keep the current classifiers", func() {
+				So(cc.Update(ctx, data.Map{
+					"file": data.String("not_exist_file"),
+				}), ShouldNotBeNil)
+				So(cc.Update(ctx, data.Map{
+					"pool_size": data.Int(3),
+				}), ShouldNotBeNil)
+				So(cc.Update(ctx, data.Map{
+					"scale_factor": data.Float(0.5),
+				}), ShouldNotBeNil)
+				So(cc.pool, ShouldEqual, oldPool)
+				So(cc.filePath, ShouldEqual, "_test_for_reload.xml")
+			})
+		})
+
+		Convey("When reload a terminated state", func() {
+			So(st.Terminate(ctx), ShouldBeNil)
+			_, err := ReloadCascadeClassifier(ctx, "test_classifier")
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestCascadeClassifierConcurrentReload(t *testing.T) {
+	Convey("Given a cascade classifier state used by many goroutines", t, func() {
+		ctx := core.NewContext(nil)
+		createTestCascadeFile("_test_for_concurrent_reload.xml")
+		Reset(func() {
+			os.Remove("_test_for_concurrent_reload.xml")
+		})
+		st, err := NewCascadeClassifier(ctx, data.Map{
+			"file":      data.String("_test_for_concurrent_reload.xml"),
+			"pool_size": data.Int(2),
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("test_classifier", "opencv_cascade_classifier",
+			st), ShouldBeNil)
+		Reset(func() {
+			st.Terminate(ctx)
+		})
+		cc, _ := st.(*cascadeClassifier)
+		img := testRawData(64, 64).ConvertToDataMap()
+
+		Convey("When reload it while detections are in flight", func() {
+			const n = 8
+			detectErrs := make(chan error, n*20)
+			reloadErrs := make(chan error, 20)
+			wg := sync.WaitGroup{}
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 20; j++ {
+						_, err := DetectMultiScale(ctx, "test_classifier", img)
+						detectErrs <- err
+					}
+				}()
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					_, err := ReloadCascadeClassifier(ctx, "test_classifier")
+					reloadErrs <- err
+					reloadErrs <- cc.Update(ctx, data.Map{
+						"min_neighbors": data.Int(j + 1),
+					})
+				}
+			}()
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+
+			Convey("Then all detections and reloads should finish without errors", func() {
+				select {
+				case <-done:
+				case <-time.After(30 * time.Second):
+					So("detections and reloads deadlocked", ShouldBeEmpty)
+				}
+				close(detectErrs)
+				close(reloadErrs)
+				for err := range detectErrs {
+					So(err, ShouldBeNil)
+				}
+				for err := range reloadErrs {
+					So(err, ShouldBeNil)
+				}
+				So(len(cc.pool.classifiers), ShouldEqual, 2)
+				So(cc.opts.params.MinNeighbors, ShouldEqual, 10)
+			})
+		})
+	})
+}
+
+func TestCascadeClassifierConcurrentSlowDetection(t *testing.T) {
+	Convey("Given a cascade classifier state of a classifier", t, func() {
+		ctx := core.NewContext(nil)
+		createTestCascadeFile("_test_for_slow_detect.xml")
+		Reset(func() {
+			os.Remove("_test_for_slow_detect.xml")
+		})
+		st, err := NewCascadeClassifier(ctx, data.Map{
+			"file": data.String("_test_for_slow_detect.xml"),
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("test_classifier", "opencv_cascade_classifier",
+			st), ShouldBeNil)
+		Reset(func() {
+			st.Terminate(ctx)
+		})
+		cc, _ := st.(*cascadeClassifier)
+		oldPool := cc.pool
+		img := testRawData(16, 16).ConvertToDataMap()
+
+		Convey("When update it while a slow detection is running", func() {
+			started := make(chan struct{})
+			release := make(chan struct{})
+			slow := make(chan error, 1)
+			go func() {
+				slow <- cc.use(func(c *bridge.CascadeClassifier,
+					opts detectOptions) error {
+					close(started)
+					<-release
+					return nil
+				})
+			}()
+			<-started
+			Reset(func() {
+				select {
+				case <-release:
+				default:
+					close(release)
+				}
+			})
+
+			updated := make(chan error, 1)
+			go func() {
+				updated <- cc.Update(ctx, data.Map{"min_neighbors": data.Int(5)})
+			}()
+			detected := make(chan error, 1)
+
+			Convey("Then the update and a following detection should not wait for it", func() {
+				select {
+				case err := <-updated:
+					So(err, ShouldBeNil)
+				case <-time.After(5 * time.Second):
+					So("update waited for the slow detection", ShouldBeEmpty)
+				}
+				go func() {
+					_, err := DetectMultiScale(ctx, "test_classifier", img)
+					detected <- err
+				}()
+				select {
+				case err := <-detected:
+					So(err, ShouldBeNil)
+				case <-time.After(5 * time.Second):
+					So("detection waited for the slow detection", ShouldBeEmpty)
+				}
+
+				Convey("And the old classifiers should be deleted after it finishes", func() {
+					close(release)
+					So(<-slow, ShouldBeNil)
+					for i := 0; i < 100 && len(oldPool.classifiers) > 0; i++ {
+						time.Sleep(10 * time.Millisecond)
+					}
+					So(len(oldPool.classifiers), ShouldEqual, 0)
+				})
+			})
+		})
+
+		Convey("When update it concurrently with different options", func() {
+			wg := sync.WaitGroup{}
+			errs := make(chan error, 2)
+			for _, params := range []data.Map{
+				{"min_neighbors": data.Int(7)},
+				{"scale_factor": data.Float(1.3)},
+			} {
+				params := params
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- cc.Update(ctx, params)
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			Convey("Then both options should be kept", func() {
+				for err := range errs {
+					So(err, ShouldBeNil)
+				}
+				So(cc.opts.params.MinNeighbors, ShouldEqual, 7)
+				So(cc.opts.params.ScaleFactor, ShouldEqual, 1.3)
+			})
+		})
+	})
+}
+
+func TestToDetectOptions(t *testing.T) {
+	Convey("Given detection options of a state", t, func() {
+		base := detectOptions{
+			params: bridge.DetectParams{
+				ScaleFactor:  1.2,
+				MinNeighbors: 5,
+				MinWidth:     30,
+				MinHeight:    30,
+			},
+		}
+		Convey("When override a part of them", func() {
+			opts, err := toDetectOptions(data.Map{
+				"min_neighbors":        data.Int(1),
+				"output_reject_levels": data.True,
+			}, base)
+			Convey("Then only the given options should be changed", func() {
+				So(err, ShouldBeNil)
+				expected := base
+				expected.params.MinNeighbors = 1
+				expected.outputRejectLevels = true
+				So(opts, ShouldResemble, expected)
+			})
+		})
+
+		Convey("When give a ROI", func() {
+			roi := data.Map{
+				"x":      data.Int(10),
+				"y":      data.Int(20),
+				"width":  data.Int(30),
+				"height": data.Int(40),
+			}
+			Convey("Then the ROI should be parsed from a map", func() {
+				opts, err := toDetectOptions(data.Map{"roi": roi}, base)
+				So(err, ShouldBeNil)
+				So(opts.rois, ShouldResemble, []bridge.Rect{
+					{X: 10, Y: 20, Width: 30, Height: 40},
+				})
+			})
+			Convey("Then ROIs should be parsed from an array", func() {
+				opts, err := toDetectOptions(data.Map{
+					"roi": data.Array{roi, roi},
+				}, base)
+				So(err, ShouldBeNil)
+				So(len(opts.rois), ShouldEqual, 2)
+			})
+			Convey("Then an invalid ROI should return an error", func() {
+				roi["width"] = data.Int(0)
+				_, err := toDetectOptions(data.Map{"roi": roi}, base)
+				So(err, ShouldNotBeNil)
+				_, err = toDetectOptions(data.Map{"roi": data.String("a")}, base)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestDetectMultiScaleArguments(t *testing.T) {
+	Convey("Given a SensorBee's core.Context", t, func() {
+		ctx := &core.Context{}
+		img := testRawData(8, 8).ConvertToDataMap()
+		Convey("When detect with too many arguments", func() {
+			_, err := DetectMultiScale(ctx, "classifier", img, data.Map{}, data.Map{})
+			Convey("Then should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestDetectMultiScaleTinyImage(t *testing.T) {
+	Convey("Given a cascade classifier state", t, func() {
+		ctx := core.NewContext(nil)
+		createTestCascadeFile("_test_for_tiny_detect.xml")
+		Reset(func() {
+			os.Remove("_test_for_tiny_detect.xml")
+		})
+		st, err := NewCascadeClassifier(ctx, data.Map{
+			"file": data.String("_test_for_tiny_detect.xml"),
+		})
+		So(err, ShouldBeNil)
+		So(ctx.SharedStates.Add("test_classifier", "opencv_cascade_classifier",
+			st), ShouldBeNil)
+		Reset(func() {
+			st.Terminate(ctx)
+		})
+		img := testRawData(4, 4).ConvertToDataMap()
+
+		for _, levels := range []bool{false, true} {
+			levels := levels
+			msg := fmt.Sprintf("with output_reject_levels=%v", levels)
+			Convey("When detect with a scale which shrinks the image to nothing "+msg,
+				func() {
+					ret, err := DetectMultiScale(ctx, "test_classifier", img, data.Map{
+						"detect_scale":         data.Float(0.1),
+						"output_reject_levels": data.Bool(levels),
+					})
+					Convey("Then no object should be detected", func() {
+						So(err, ShouldBeNil)
+						So(ret, ShouldBeEmpty)
+					})
+				})
+		}
+
+		Convey("When detect in tiny ROIs", func() {
+			roi := func(x, y, w, h int) data.Map {
+				return data.Map{
+					"x":      data.Int(x),
+					"y":      data.Int(y),
+					"width":  data.Int(w),
+					"height": data.Int(h),
+				}
+			}
+			rois := data.Array{
+				roi(1, 1, 2, 2),   // shrunk to nothing by detect_scale
+				roi(3, 3, 10, 10), // clipped to 1x1 by the image
+				roi(10, 10, 5, 5), // out of the image
+			}
+			Convey("Then no object should be detected", func() {
+				for _, levels := range []bool{false, true} {
+					ret, err := DetectMultiScale(ctx, "test_classifier", img, data.Map{
+						"roi":                  rois,
+						"detect_scale":         data.Float(0.3),
+						"output_reject_levels": data.Bool(levels),
+					})
+					So(err, ShouldBeNil)
+					So(ret, ShouldBeEmpty)
+				}
 			})
 		})
 	})
@@ -104,3 +649,127 @@ func TestNewSharedImage(t *testing.T) {
 		})
 	})
 }
+
+func TestDrawRectsToImageFormats(t *testing.T) {
+	Convey("Given images of each format", t, func() {
+		raw := testRawData(32, 24)
+		rects := data.Array{
+			data.Map{
+				"x":      data.Int(4),
+				"y":      data.Int(4),
+				"width":  data.Int(10),
+				"height": data.Int(10),
+			},
+		}
+		for _, f := range []TypeImageFormat{TypeCVMAT, TypeCVMAT4b, TypeJPEG, TypePNG} {
+			f := f
+			Convey("When draw rects to "+f.String()+" image", func() {
+				img := raw
+				if f == TypeCVMAT4b {
+					mat, err := raw.ToMatVec3b()
+					So(err, ShouldBeNil)
+					img, err = ToRawDataWithFormat(mat, TypeCVMAT4b)
+					mat.Delete()
+					So(err, ShouldBeNil)
+				} else if f != TypeCVMAT {
+					var err error
+					img, err = raw.Encode(f, -1)
+					So(err, ShouldBeNil)
+				}
+				ret, err := DrawRectsToImage(img.ConvertToDataMap(), rects)
+				So(err, ShouldBeNil)
+
+				Convey("Then the returned image should have the same format", func() {
+					retRaw, err := ConvertMapToRawData(ret)
+					So(err, ShouldBeNil)
+					So(retRaw.Format, ShouldEqual, f)
+					So(retRaw.Width, ShouldEqual, 32)
+					So(retRaw.Height, ShouldEqual, 24)
+					So(retRaw.Data, ShouldNotResemble, img.Data)
+				})
+			})
+		}
+	})
+}
+
+func TestDrawRectsToImageStyles(t *testing.T) {
+	Convey("Given a black image", t, func() {
+		raw := RawData{
+			Format: TypeCVMAT,
+			Width:  64,
+			Height: 48,
+			Data:   make([]byte, 64*48*3),
+		}
+		img := raw.ConvertToDataMap()
+		rect := data.Map{
+			"x":      data.Int(10),
+			"y":      data.Int(20),
+			"width":  data.Int(20),
+			"height": data.Int(20),
+		}
+		pixel := func(m data.Map, x, y int) []byte {
+			r, err := ConvertMapToRawData(m)
+			So(err, ShouldBeNil)
+			i := (y*r.Width + x) * 3
+			return r.Data[i : i+3]
+		}
+
+		Convey("When draw a rect with a color of the call", func() {
+			ret, err := DrawRectsToImage(img, data.Array{rect}, data.Map{
+				"color":     data.Array{data.Int(255), data.Int(0), data.Int(0)},
+				"thickness": data.Int(1),
+			})
+			So(err, ShouldBeNil)
+			Convey("Then the rect should be drawn in the color", func() {
+				p := pixel(ret, 10, 30)
+				So(p[0], ShouldBeGreaterThan, 0)
+				So(p[1], ShouldEqual, 0)
+				So(p[2], ShouldEqual, 0)
+			})
+		})
+
+		Convey("When draw a rect with a color of the rect", func() {
+			rect["color"] = data.Array{data.Int(0), data.Int(0), data.Int(255)}
+			ret, err := DrawRectsToImage(img, data.Array{rect}, data.Map{
+				"color": data.Array{data.Int(255), data.Int(0), data.Int(0)},
+			})
+			So(err, ShouldBeNil)
+			Convey("Then the color of the rect should be used", func() {
+				p := pixel(ret, 10, 30)
+				So(p[0], ShouldEqual, 0)
+				So(p[2], ShouldBeGreaterThan, 0)
+			})
+		})
+
+		Convey("When draw a rect with a label", func() {
+			noLabel, err := DrawRectsToImage(img, data.Array{rect})
+			So(err, ShouldBeNil)
+			rect["label"] = data.String("face")
+			rect["font_scale"] = data.Float(0.4)
+			ret, err := DrawRectsToImage(img, data.Array{rect})
+			So(err, ShouldBeNil)
+			Convey("Then the label should be drawn", func() {
+				So(ret["image"], ShouldNotResemble, noLabel["image"])
+			})
+		})
+
+		Convey("When draw a rect with invalid styles", func() {
+			Convey("Then an error should occur", func() {
+				testMap := map[string]data.Value{
+					"color":      data.Array{data.Int(0), data.Int(0)},
+					"thickness":  data.Int(0),
+					"font_scale": data.Float(-1),
+				}
+				for k, v := range testMap {
+					_, err := DrawRectsToImage(img, data.Array{rect}, data.Map{k: v})
+					So(err, ShouldNotBeNil)
+				}
+				rect["color"] = data.Array{data.Int(0), data.Int(0), data.Int(256)}
+				_, err := DrawRectsToImage(img, data.Array{rect})
+				So(err, ShouldNotBeNil)
+				_, err = DrawRectsToImage(img, data.Array{rect}, data.Map{}, data.Map{})
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
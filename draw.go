@@ -0,0 +1,310 @@
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+var (
+	colorPath     = data.MustCompilePath("color")
+	thicknessPath = data.MustCompilePath("thickness")
+	labelPath     = data.MustCompilePath("label")
+	fontScalePath = data.MustCompilePath("font_scale")
+	closedPath    = data.MustCompilePath("closed")
+)
+
+// drawStyle is a style of figures drawn on images.
+type drawStyle struct {
+	color     bridge.Color
+	thickness int
+	label     string
+	fontScale float64
+}
+
+var defaultDrawStyle = drawStyle{
+	color:     bridge.Color{B: 0, G: 200, R: 0},
+	thickness: 3,
+	fontScale: 0.5,
+}
+
+// toDrawStyle returns a style which overwrites base by the style fields of
+// the map. Fields which are not given keep the values of base.
+func toDrawStyle(m data.Map, base drawStyle) (drawStyle, error) {
+	st := base
+	if c, err := m.Get(colorPath); err == nil {
+		if st.color, err = toColor(c); err != nil {
+			return st, err
+		}
+	}
+	if t, err := m.Get(thicknessPath); err == nil {
+		thickness, err := data.AsInt(t)
+		if err != nil {
+			return st, err
+		}
+		if thickness == 0 {
+			return st, fmt.Errorf("thickness must not be 0")
+		}
+		st.thickness = int(thickness)
+	}
+	if l, err := m.Get(labelPath); err == nil {
+		if st.label, err = data.ToString(l); err != nil {
+			return st, err
+		}
+	}
+	if fs, err := m.Get(fontScalePath); err == nil {
+		if st.fontScale, err = data.ToFloat(fs); err != nil {
+			return st, err
+		}
+		if st.fontScale <= 0 {
+			return st, fmt.Errorf("font_scale must be greater than 0: %v",
+				st.fontScale)
+		}
+	}
+	return st, nil
+}
+
+// toOptionalDrawStyle returns a style from an optional style argument of
+// UDFs.
+func toOptionalDrawStyle(style []data.Map, base drawStyle) (drawStyle, error) {
+	if len(style) > 1 {
+		return base, fmt.Errorf("too many arguments")
+	}
+	if len(style) == 0 {
+		return base, nil
+	}
+	return toDrawStyle(style[0], base)
+}
+
+// toColor converts an array of [blue, green, red] to a color.
+func toColor(v data.Value) (bridge.Color, error) {
+	a, err := data.AsArray(v)
+	if err != nil {
+		return bridge.Color{}, err
+	}
+	if len(a) != 3 {
+		return bridge.Color{}, fmt.Errorf(
+			"color must be an array of [blue, green, red]: %v", v)
+	}
+	var bgr [3]int
+	for i, e := range a {
+		c, err := data.ToInt(e)
+		if err != nil {
+			return bridge.Color{}, err
+		}
+		if c < 0 || c > 255 {
+			return bridge.Color{}, fmt.Errorf("color must be in [0, 255]: %v", c)
+		}
+		bgr[i] = int(c)
+	}
+	return bridge.Color{B: bgr[0], G: bgr[1], R: bgr[2]}, nil
+}
+
+// toPoint converts a map of "x" and "y" to a point.
+func toPoint(v data.Value) (bridge.Point, error) {
+	m, err := data.AsMap(v)
+	if err != nil {
+		return bridge.Point{}, err
+	}
+	var x int64
+	if xv, err := m.Get(xPath); err != nil {
+		return bridge.Point{}, err
+	} else if x, err = data.ToInt(xv); err != nil {
+		return bridge.Point{}, err
+	}
+	var y int64
+	if yv, err := m.Get(yPath); err != nil {
+		return bridge.Point{}, err
+	} else if y, err = data.ToInt(yv); err != nil {
+		return bridge.Point{}, err
+	}
+	return bridge.Point{X: int(x), Y: int(y)}, nil
+}
+
+// toPoints converts an array of point maps to points. The array must have at
+// least min points.
+func toPoints(a data.Array, min int) ([]bridge.Point, error) {
+	if len(a) < min {
+		return nil, fmt.Errorf("at least %v points are required: %v", min,
+			len(a))
+	}
+	pts := make([]bridge.Point, len(a))
+	for i, v := range a {
+		p, err := toPoint(v)
+		if err != nil {
+			return nil, err
+		}
+		pts[i] = p
+	}
+	return pts, nil
+}
+
+// drawOnImage calls draw with a copy of the image, and returns the drawn
+// image which has the same format and color mode as the original. The image
+// is required to structured as RawData.
+func drawOnImage(img data.Map, draw func(mat bridge.MatVec3b)) (data.Map,
+	error) {
+	raw, err := ConvertMapToRawData(img)
+	if err != nil {
+		return nil, err
+	}
+	// copy image binary
+	temp := make([]byte, len(raw.Data))
+	copy(temp, raw.Data)
+	raw.Data = temp
+	mat, err := raw.ToMatVec3b()
+	if err != nil {
+		return nil, err
+	}
+	defer mat.Delete()
+
+	draw(mat)
+	retRaw, err := toRawDataLike(mat, raw)
+	if err != nil {
+		return nil, err
+	}
+	return retRaw.ConvertToDataMap(), nil
+}
+
+// DrawText draws a text on the image, e.g. a timestamp. The image is required
+// to structured as RawData, and the returned image has the same format and
+// color mode as the image.
+//
+// org: The bottom-left corner of the text as a map of "x" and "y".
+//
+// style: An optional map of "color", "thickness" and "font_scale". Default
+// thickness of texts is 1, and others are the same as DrawRectsToImage.
+func DrawText(img data.Map, text string, org data.Map, style ...data.Map) (
+	data.Map, error) {
+	base := defaultDrawStyle
+	base.thickness = 1
+	st, err := toOptionalDrawStyle(style, base)
+	if err != nil {
+		return nil, err
+	}
+	pt, err := toPoint(org)
+	if err != nil {
+		return nil, err
+	}
+	return drawOnImage(img, func(mat bridge.MatVec3b) {
+		bridge.DrawText(mat, text, pt, st.fontScale, st.color, st.thickness)
+	})
+}
+
+// DrawLine draws a line segment on the image, e.g. a counting line. The image
+// is required to structured as RawData, and the returned image has the same
+// format and color mode as the image.
+//
+// from, to: The end points of the line as maps of "x" and "y".
+//
+// style: An optional map of "color" and "thickness". Defaults are the same as
+// DrawRectsToImage.
+func DrawLine(img data.Map, from data.Map, to data.Map, style ...data.Map) (
+	data.Map, error) {
+	st, err := toOptionalDrawStyle(style, defaultDrawStyle)
+	if err != nil {
+		return nil, err
+	}
+	if st.thickness < 0 {
+		return nil, fmt.Errorf("thickness of lines must be greater than 0: %v",
+			st.thickness)
+	}
+	pt1, err := toPoint(from)
+	if err != nil {
+		return nil, err
+	}
+	pt2, err := toPoint(to)
+	if err != nil {
+		return nil, err
+	}
+	return drawOnImage(img, func(mat bridge.MatVec3b) {
+		bridge.DrawLine(mat, pt1, pt2, st.color, st.thickness)
+	})
+}
+
+// DrawCircle draws a circle on the image. The image is required to structured
+// as RawData, and the returned image has the same format and color mode as
+// the image.
+//
+// center: The center of the circle as a map of "x" and "y".
+//
+// radius: The radius of the circle, it must not be negative.
+//
+// style: An optional map of "color" and "thickness". A negative thickness
+// fills the circle. Defaults are the same as DrawRectsToImage.
+func DrawCircle(img data.Map, center data.Map, radius int, style ...data.Map) (
+	data.Map, error) {
+	st, err := toOptionalDrawStyle(style, defaultDrawStyle)
+	if err != nil {
+		return nil, err
+	}
+	if radius < 0 {
+		return nil, fmt.Errorf("radius must not be negative: %v", radius)
+	}
+	pt, err := toPoint(center)
+	if err != nil {
+		return nil, err
+	}
+	return drawOnImage(img, func(mat bridge.MatVec3b) {
+		bridge.DrawCircle(mat, pt, radius, st.color, st.thickness)
+	})
+}
+
+// DrawPolylines draws a polygonal curve through the points on the image, e.g.
+// a boundary of a zone. The image is required to structured as RawData, and
+// the returned image has the same format and color mode as the image.
+//
+// points: An array of at least 2 maps of "x" and "y".
+//
+// style: An optional map of "color", "thickness" and "closed". When "closed"
+// is true, the last point is connected to the first one. Default of "closed"
+// is true, and the others are the same as DrawRectsToImage.
+func DrawPolylines(img data.Map, points data.Array, style ...data.Map) (
+	data.Map, error) {
+	st, err := toOptionalDrawStyle(style, defaultDrawStyle)
+	if err != nil {
+		return nil, err
+	}
+	if st.thickness < 0 {
+		return nil, fmt.Errorf("thickness of lines must be greater than 0: %v",
+			st.thickness)
+	}
+	closed := true
+	if len(style) == 1 {
+		if c, err := style[0].Get(closedPath); err == nil {
+			if closed, err = data.AsBool(c); err != nil {
+				return nil, err
+			}
+		}
+	}
+	pts, err := toPoints(points, 2)
+	if err != nil {
+		return nil, err
+	}
+	return drawOnImage(img, func(mat bridge.MatVec3b) {
+		bridge.DrawPolylines(mat, pts, closed, st.color, st.thickness)
+	})
+}
+
+// FillPoly fills the polygon of the points on the image, e.g. a masked zone.
+// The image is required to structured as RawData, and the returned image has
+// the same format and color mode as the image.
+//
+// points: An array of at least 3 maps of "x" and "y".
+//
+// style: An optional map of "color". Default is the same as
+// DrawRectsToImage.
+func FillPoly(img data.Map, points data.Array, style ...data.Map) (data.Map,
+	error) {
+	st, err := toOptionalDrawStyle(style, defaultDrawStyle)
+	if err != nil {
+		return nil, err
+	}
+	pts, err := toPoints(points, 3)
+	if err != nil {
+		return nil, err
+	}
+	return drawOnImage(img, func(mat bridge.MatVec3b) {
+		bridge.FillPoly(mat, pts, st.color)
+	})
+}
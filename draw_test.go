@@ -0,0 +1,122 @@
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func testPoint(x, y int) data.Map {
+	return data.Map{
+		"x": data.Int(x),
+		"y": data.Int(y),
+	}
+}
+
+func TestDrawFigures(t *testing.T) {
+	Convey("Given a black image", t, func() {
+		raw := RawData{
+			Format: TypeCVMAT,
+			Width:  64,
+			Height: 48,
+			Data:   make([]byte, 64*48*3),
+		}
+		img := raw.ConvertToDataMap()
+		red := data.Map{
+			"color": data.Array{data.Int(0), data.Int(0), data.Int(255)},
+		}
+		pixel := func(m data.Map, x, y int) []byte {
+			r, err := ConvertMapToRawData(m)
+			So(err, ShouldBeNil)
+			i := (y*r.Width + x) * 3
+			return r.Data[i : i+3]
+		}
+
+		Convey("When draw a text", func() {
+			ret, err := DrawText(img, "12:00", testPoint(2, 20), red)
+			So(err, ShouldBeNil)
+			Convey("Then the image should be changed", func() {
+				So(ret["image"], ShouldNotResemble, img["image"])
+				So(raw.Data, ShouldResemble, make([]byte, 64*48*3))
+			})
+		})
+
+		Convey("When draw a line", func() {
+			ret, err := DrawLine(img, testPoint(0, 24), testPoint(63, 24), red)
+			So(err, ShouldBeNil)
+			Convey("Then the line should be drawn in the color", func() {
+				p := pixel(ret, 32, 24)
+				So(p[0], ShouldEqual, 0)
+				So(p[2], ShouldBeGreaterThan, 0)
+			})
+		})
+
+		Convey("When draw a filled circle", func() {
+			ret, err := DrawCircle(img, testPoint(32, 24), 10, data.Map{
+				"thickness": data.Int(-1),
+			})
+			So(err, ShouldBeNil)
+			Convey("Then the center should be filled", func() {
+				p := pixel(ret, 32, 24)
+				So(p[1], ShouldEqual, 200)
+			})
+		})
+
+		Convey("When draw polylines", func() {
+			pts := data.Array{testPoint(5, 5), testPoint(50, 5), testPoint(50, 40)}
+			closed, err := DrawPolylines(img, pts)
+			So(err, ShouldBeNil)
+			open, err := DrawPolylines(img, pts, data.Map{"closed": data.False})
+			So(err, ShouldBeNil)
+			Convey("Then only the closed curve should have the last segment", func() {
+				So(closed["image"], ShouldNotResemble, open["image"])
+				So(pixel(open, 27, 22)[1], ShouldEqual, 0)
+				So(pixel(closed, 27, 22)[1], ShouldBeGreaterThan, 0)
+			})
+		})
+
+		Convey("When fill a polygon", func() {
+			pts := data.Array{testPoint(10, 10), testPoint(50, 10),
+				testPoint(50, 40), testPoint(10, 40)}
+			ret, err := FillPoly(img, pts, red)
+			So(err, ShouldBeNil)
+			Convey("Then the inside should be filled", func() {
+				So(pixel(ret, 30, 25), ShouldResemble, []byte{0, 0, 255})
+				So(pixel(ret, 5, 5), ShouldResemble, []byte{0, 0, 0})
+			})
+		})
+
+		Convey("When draw on a JPEG image", func() {
+			jpg, err := EncodeImage(img, "jpeg")
+			So(err, ShouldBeNil)
+			ret, err := DrawLine(jpg, testPoint(0, 0), testPoint(63, 47))
+			Convey("Then the returned image should be JPEG", func() {
+				So(err, ShouldBeNil)
+				So(ret["format"], ShouldEqual, data.String("jpeg"))
+			})
+		})
+
+		Convey("When draw with invalid arguments", func() {
+			Convey("Then an error should occur", func() {
+				_, err := DrawLine(img, testPoint(0, 0), data.Map{"x": data.Int(1)})
+				So(err, ShouldNotBeNil)
+				_, err = DrawLine(img, testPoint(0, 0), testPoint(1, 1),
+					data.Map{"thickness": data.Int(-1)})
+				So(err, ShouldNotBeNil)
+				_, err = DrawCircle(img, testPoint(0, 0), -1)
+				So(err, ShouldNotBeNil)
+				_, err = DrawPolylines(img, data.Array{testPoint(0, 0)})
+				So(err, ShouldNotBeNil)
+				_, err = DrawPolylines(img, data.Array{testPoint(0, 0), testPoint(1, 1)},
+					data.Map{"closed": data.Int(1)})
+				So(err, ShouldNotBeNil)
+				_, err = FillPoly(img, data.Array{testPoint(0, 0), testPoint(1, 1)})
+				So(err, ShouldNotBeNil)
+				_, err = DrawText(img, "a", testPoint(0, 0), data.Map{}, data.Map{})
+				So(err, ShouldNotBeNil)
+				_, err = DrawText(data.Map{}, "a", testPoint(0, 0))
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
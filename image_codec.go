@@ -0,0 +1,104 @@
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+)
+
+var (
+	qualityPath = data.MustCompilePath("quality")
+)
+
+// EncodeImage converts the image to the format, e.g. "jpeg", "png" and
+// "cvmat". The image is required to structured as RawData.
+//
+// params: An optional map of encoding parameters.
+//
+// quality: The quality of JPEG and WebP from 0 to 100, default is the value
+// of OpenCV. When it is given, an image of the format is decoded and encoded
+// again with the quality, e.g. to recompress JPEG images.
+func EncodeImage(img data.Map, format string, params ...data.Map) (data.Map,
+	error) {
+	if len(params) > 1 {
+		return nil, fmt.Errorf("too many arguments")
+	}
+	f := GetTypeImageFormat(format)
+	if f == typeUnknownFormat {
+		return nil, fmt.Errorf("'%v' is not supported", format)
+	}
+
+	quality := int64(-1) // default of OpenCV
+	if len(params) == 1 {
+		if q, err := params[0].Get(qualityPath); err == nil {
+			if quality, err = data.AsInt(q); err != nil {
+				return nil, err
+			}
+			if quality < 0 || quality > 100 {
+				return nil, fmt.Errorf("quality must be in [0, 100]: %v", quality)
+			}
+		}
+	}
+
+	raw, err := ConvertMapToRawData(img)
+	if err != nil {
+		return nil, err
+	}
+	// an image of the format is re-encoded only when the quality is given
+	if raw.Format == f && (quality < 0 || f.extension() == "") {
+		return img, nil
+	}
+	mat, err := raw.ToMatVec3b()
+	if err != nil {
+		return nil, err
+	}
+	defer mat.Delete()
+
+	var ret RawData
+	if f.extension() != "" {
+		ret, err = encodeMatVec3b(mat, f, int(quality))
+	} else {
+		ret, err = ToRawDataWithFormat(mat, f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ret.ConvertToDataMap(), nil
+}
+
+// DecodeImage converts the image to "cvmat" format in BGR. The image is
+// required to structured as RawData. "cvmat" in other color modes, e.g. RGB,
+// is converted to BGR.
+func DecodeImage(img data.Map) (data.Map, error) {
+	raw, err := ConvertMapToRawData(img)
+	if err != nil {
+		return nil, err
+	}
+	if raw.Format == TypeCVMAT && raw.mode() == ModeBGR {
+		return img, nil
+	}
+	ret, err := raw.Decode()
+	if err != nil {
+		return nil, err
+	}
+	return ret.ConvertToDataMap(), nil
+}
+
+// ConvertColor converts the channel order of the image to the mode, "BGR",
+// "RGB", "BGRA", "RGBA" or "GRAY". The image is required to structured as
+// RawData. Encoded images are decoded before the conversion, and the returned
+// image has a raw format, e.g. "cvmat" for "RGB" and "cvmat_gray" for "GRAY".
+func ConvertColor(img data.Map, mode string) (data.Map, error) {
+	m := GetTypeColorMode(mode)
+	if m == modeDefault {
+		return nil, fmt.Errorf("'%v' color mode is not supported", mode)
+	}
+	raw, err := ConvertMapToRawData(img)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := raw.ConvertColor(m)
+	if err != nil {
+		return nil, err
+	}
+	return ret.ConvertToDataMap(), nil
+}
@@ -0,0 +1,174 @@
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestEncodeImage(t *testing.T) {
+	Convey("Given a cvmat image", t, func() {
+		raw := testRawData(32, 24)
+		img := raw.ConvertToDataMap()
+
+		Convey("When encode it to JPEG with quality", func() {
+			low, err := EncodeImage(img, "jpeg", data.Map{"quality": data.Int(10)})
+			So(err, ShouldBeNil)
+			high, err := EncodeImage(img, "jpeg", data.Map{"quality": data.Int(100)})
+			So(err, ShouldBeNil)
+			Convey("Then the image should be JPEG of the quality", func() {
+				So(low["format"], ShouldEqual, data.String("jpeg"))
+				So(low["width"], ShouldEqual, data.Int(32))
+				So(low["height"], ShouldEqual, data.Int(24))
+				lowImg, _ := data.AsBlob(low["image"])
+				highImg, _ := data.AsBlob(high["image"])
+				So(len(lowImg), ShouldBeLessThan, len(highImg))
+			})
+		})
+
+		Convey("When encode it to PNG and decode it", func() {
+			png, err := EncodeImage(img, "png")
+			So(err, ShouldBeNil)
+			So(png["format"], ShouldEqual, data.String("png"))
+			dec, err := DecodeImage(png)
+			So(err, ShouldBeNil)
+			Convey("Then the image should be same as the original", func() {
+				So(dec, ShouldResemble, img)
+			})
+		})
+
+		Convey("When encode it to cvmat4b", func() {
+			ret, err := EncodeImage(img, "cvmat4b")
+			So(err, ShouldBeNil)
+			Convey("Then the image should have alpha channel", func() {
+				So(ret["format"], ShouldEqual, data.String("cvmat4b"))
+				b, _ := data.AsBlob(ret["image"])
+				So(len(b), ShouldEqual, 32*24*4)
+			})
+		})
+
+		Convey("When encode it to the same format", func() {
+			ret, err := EncodeImage(img, "cvmat")
+			Convey("Then the image should be returned as it is", func() {
+				So(err, ShouldBeNil)
+				So(ret, ShouldResemble, img)
+			})
+		})
+
+		Convey("When encode a JPEG image to JPEG with quality", func() {
+			jpg, err := EncodeImage(img, "jpeg", data.Map{"quality": data.Int(100)})
+			So(err, ShouldBeNil)
+			ret, err := EncodeImage(jpg, "jpeg", data.Map{"quality": data.Int(10)})
+			So(err, ShouldBeNil)
+			Convey("Then the image should be recompressed", func() {
+				So(ret["format"], ShouldEqual, data.String("jpeg"))
+				orig, _ := data.AsBlob(jpg["image"])
+				recompressed, _ := data.AsBlob(ret["image"])
+				So(len(recompressed), ShouldBeLessThan, len(orig))
+			})
+			Convey("Then the image should be returned as it is without quality", func() {
+				same, err := EncodeImage(jpg, "jpeg")
+				So(err, ShouldBeNil)
+				So(same, ShouldResemble, jpg)
+			})
+		})
+
+		Convey("When encode it with invalid arguments", func() {
+			Convey("Then an error should occur", func() {
+				_, err := EncodeImage(img, "gif")
+				So(err, ShouldNotBeNil)
+				_, err = EncodeImage(img, "jpeg", data.Map{"quality": data.Int(101)})
+				So(err, ShouldNotBeNil)
+				_, err = EncodeImage(img, "jpeg", data.Map{"quality": data.String("a")})
+				So(err, ShouldNotBeNil)
+				_, err = EncodeImage(img, "jpeg", data.Map{}, data.Map{})
+				So(err, ShouldNotBeNil)
+				_, err = EncodeImage(data.Map{}, "jpeg")
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestDecodeImage(t *testing.T) {
+	Convey("Given a JPEG image", t, func() {
+		raw := testRawData(32, 24)
+		jpg, err := raw.Encode(TypeJPEG, 90)
+		So(err, ShouldBeNil)
+
+		Convey("When decode it", func() {
+			ret, err := DecodeImage(jpg.ConvertToDataMap())
+			Convey("Then the image should be cvmat", func() {
+				So(err, ShouldBeNil)
+				So(ret["format"], ShouldEqual, data.String("cvmat"))
+				So(ret["width"], ShouldEqual, data.Int(32))
+				So(ret["height"], ShouldEqual, data.Int(24))
+				b, _ := data.AsBlob(ret["image"])
+				So(len(b), ShouldEqual, 32*24*3)
+			})
+		})
+
+		Convey("When decode a cvmat image in RGB mode", func() {
+			rgb, err := ConvertColor(raw.ConvertToDataMap(), "RGB")
+			So(err, ShouldBeNil)
+			ret, err := DecodeImage(rgb)
+			Convey("Then the image should be converted to BGR", func() {
+				So(err, ShouldBeNil)
+				So(ret, ShouldResemble, raw.ConvertToDataMap())
+			})
+		})
+
+		Convey("When decode a cvmat image in BGR mode", func() {
+			img := raw.ConvertToDataMap()
+			ret, err := DecodeImage(img)
+			Convey("Then the image should be returned as it is", func() {
+				So(err, ShouldBeNil)
+				So(ret, ShouldResemble, img)
+			})
+		})
+
+		Convey("When decode broken data", func() {
+			jpg.Data = []byte("broken")
+			_, err := DecodeImage(jpg.ConvertToDataMap())
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestConvertColor(t *testing.T) {
+	Convey("Given a cvmat image", t, func() {
+		raw := testRawData(32, 24)
+		img := raw.ConvertToDataMap()
+
+		Convey("When convert it to RGB and back to BGR", func() {
+			rgb, err := ConvertColor(img, "RGB")
+			So(err, ShouldBeNil)
+			bgr, err := ConvertColor(rgb, "BGR")
+			So(err, ShouldBeNil)
+			Convey("Then the image should be same as the original", func() {
+				So(rgb["mode"], ShouldEqual, data.String("RGB"))
+				So(bgr, ShouldResemble, img)
+			})
+		})
+
+		Convey("When convert a JPEG image to GRAY", func() {
+			jpg, err := EncodeImage(img, "jpeg")
+			So(err, ShouldBeNil)
+			gray, err := ConvertColor(jpg, "GRAY")
+			Convey("Then the image should be decoded to cvmat_gray", func() {
+				So(err, ShouldBeNil)
+				So(gray["format"], ShouldEqual, data.String("cvmat_gray"))
+				So(gray["mode"], ShouldEqual, data.String("GRAY"))
+			})
+		})
+
+		Convey("When convert it to unsupported mode", func() {
+			_, err := ConvertColor(img, "HSV")
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -18,15 +18,51 @@ func init() {
 		&opencv.FromURICreator{})
 	bql.MustRegisterGlobalSourceCreator("opencv_capture_from_device",
 		&opencv.FromDeviceCreator{})
+	bql.MustRegisterGlobalSinkCreator("opencv_video_writer",
+		&opencv.VideoWriterCreator{})
+
+	// image format
+	udf.MustRegisterGlobalUDF("opencv_encode",
+		udf.MustConvertGeneric(opencv.EncodeImage))
+	udf.MustRegisterGlobalUDF("opencv_decode",
+		udf.MustConvertGeneric(opencv.DecodeImage))
+	udf.MustRegisterGlobalUDF("opencv_cvt_color",
+		udf.MustConvertGeneric(opencv.ConvertColor))
+
+	// transform
+	udf.MustRegisterGlobalUDF("opencv_resize",
+		udf.MustConvertGeneric(opencv.Resize))
+	udf.MustRegisterGlobalUDF("opencv_crop",
+		udf.MustConvertGeneric(opencv.Crop))
+	udf.MustRegisterGlobalUDF("opencv_flip",
+		udf.MustConvertGeneric(opencv.Flip))
+	udf.MustRegisterGlobalUDF("opencv_transpose",
+		udf.MustConvertGeneric(opencv.Transpose))
+	udf.MustRegisterGlobalUDF("opencv_rotate",
+		udf.MustConvertGeneric(opencv.Rotate))
 
 	// cascade classifier
 	udf.MustRegisterGlobalUDSCreator("opencv_cascade_classifier",
 		udf.UDSCreatorFunc(opencv.NewCascadeClassifier))
 	udf.MustRegisterGlobalUDF("opencv_detect_multi_scale",
 		udf.MustConvertGeneric(opencv.DetectMultiScale))
+	udf.MustRegisterGlobalUDF("opencv_reload_classifier",
+		udf.MustConvertGeneric(opencv.ReloadCascadeClassifier))
 	udf.MustRegisterGlobalUDF("opencv_draw_rects",
 		udf.MustConvertGeneric(opencv.DrawRectsToImage))
 
+	// drawing
+	udf.MustRegisterGlobalUDF("opencv_draw_text",
+		udf.MustConvertGeneric(opencv.DrawText))
+	udf.MustRegisterGlobalUDF("opencv_draw_line",
+		udf.MustConvertGeneric(opencv.DrawLine))
+	udf.MustRegisterGlobalUDF("opencv_draw_circle",
+		udf.MustConvertGeneric(opencv.DrawCircle))
+	udf.MustRegisterGlobalUDF("opencv_draw_polylines",
+		udf.MustConvertGeneric(opencv.DrawPolylines))
+	udf.MustRegisterGlobalUDF("opencv_fill_poly",
+		udf.MustConvertGeneric(opencv.FillPoly))
+
 	// mount image
 	udf.MustRegisterGlobalUDSCreator("opencv_shared_image",
 		udf.UDSCreatorFunc(opencv.NewSharedImage))
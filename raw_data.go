@@ -1,16 +1,16 @@
 package opencv
 
 import (
-	"bytes"
 	"fmt"
 	"gopkg.in/sensorbee/opencv.v0/bridge"
 	"gopkg.in/sensorbee/sensorbee.v0/data"
-	"image"
-	"image/jpeg"
 )
 
 var (
-	imagePath = data.MustCompilePath("image")
+	imagePath    = data.MustCompilePath("image")
+	channelsPath = data.MustCompilePath("channels")
+	depthPath    = data.MustCompilePath("depth")
+	modePath     = data.MustCompilePath("mode")
 )
 
 // TypeImageFormat is an ID of image format type.
@@ -24,6 +24,17 @@ const (
 	TypeCVMAT4b
 	// TypeJPEG is JPEG format
 	TypeJPEG
+	// TypePNG is PNG format
+	TypePNG
+	// TypeWebP is WebP format, available when OpenCV is built with libwebp
+	TypeWebP
+	// TypeBMP is BMP format
+	TypeBMP
+	// TypeCVMATGray is OpenCV cv::Mat of CV_8UC1 format
+	TypeCVMATGray
+	// TypeCVMATF32 is OpenCV cv::Mat of CV_32FC(n) format, the number of
+	// channels is given by RawData.Channels
+	TypeCVMATF32
 )
 
 func (t TypeImageFormat) String() string {
@@ -34,11 +45,62 @@ func (t TypeImageFormat) String() string {
 		return "cvmat4b"
 	case TypeJPEG:
 		return "jpeg"
+	case TypePNG:
+		return "png"
+	case TypeWebP:
+		return "webp"
+	case TypeBMP:
+		return "bmp"
+	case TypeCVMATGray:
+		return "cvmat_gray"
+	case TypeCVMATF32:
+		return "cvmat_f32"
 	default:
 		return "unknown"
 	}
 }
 
+// depth returns OpenCV depth of the raw format, or -1 when the format is
+// encoded.
+func (t TypeImageFormat) depth() int {
+	switch t {
+	case TypeCVMAT, TypeCVMAT4b, TypeCVMATGray:
+		return bridge.CvDepth8U
+	case TypeCVMATF32:
+		return bridge.CvDepth32F
+	default:
+		return -1
+	}
+}
+
+func depthString(depth int) string {
+	switch depth {
+	case bridge.CvDepth8U:
+		return "8u"
+	case bridge.CvDepth32F:
+		return "32f"
+	default:
+		return "unknown"
+	}
+}
+
+// extension returns the file extension of the encoded format used by
+// `cv::imencode`, or empty string when the format is not encoded.
+func (t TypeImageFormat) extension() string {
+	switch t {
+	case TypeJPEG:
+		return ".jpg"
+	case TypePNG:
+		return ".png"
+	case TypeWebP:
+		return ".webp"
+	case TypeBMP:
+		return ".bmp"
+	default:
+		return ""
+	}
+}
+
 // GetTypeImageFormat returns image format type.
 func GetTypeImageFormat(str string) TypeImageFormat {
 	switch str {
@@ -48,17 +110,280 @@ func GetTypeImageFormat(str string) TypeImageFormat {
 		return TypeCVMAT4b
 	case "jpeg":
 		return TypeJPEG
+	case "png":
+		return TypePNG
+	case "webp":
+		return TypeWebP
+	case "bmp":
+		return TypeBMP
+	case "cvmat_gray":
+		return TypeCVMATGray
+	case "cvmat_f32":
+		return TypeCVMATF32
 	default:
 		return typeUnknownFormat
 	}
 }
 
+// TypeColorMode is an ID of channel order of raw image formats.
+type TypeColorMode int
+
+const (
+	// modeDefault means the default channel order of the number of
+	// channels, BGR, BGRA or GRAY.
+	modeDefault TypeColorMode = iota
+	// ModeBGR is 3 channels of blue, green and red
+	ModeBGR
+	// ModeRGB is 3 channels of red, green and blue
+	ModeRGB
+	// ModeBGRA is 4 channels of blue, green, red and alpha
+	ModeBGRA
+	// ModeRGBA is 4 channels of red, green, blue and alpha
+	ModeRGBA
+	// ModeGRAY is 1 channel of luminance
+	ModeGRAY
+)
+
+func (m TypeColorMode) String() string {
+	switch m {
+	case ModeBGR:
+		return "BGR"
+	case ModeRGB:
+		return "RGB"
+	case ModeBGRA:
+		return "BGRA"
+	case ModeRGBA:
+		return "RGBA"
+	case ModeGRAY:
+		return "GRAY"
+	default:
+		return "default"
+	}
+}
+
+// channels returns the number of channels of the mode.
+func (m TypeColorMode) channels() int {
+	switch m {
+	case ModeBGR, ModeRGB:
+		return 3
+	case ModeBGRA, ModeRGBA:
+		return 4
+	case ModeGRAY:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// defaultColorMode returns the default mode of the number of channels, or
+// modeDefault when there is no color mode for the number.
+func defaultColorMode(channels int) TypeColorMode {
+	switch channels {
+	case 1:
+		return ModeGRAY
+	case 3:
+		return ModeBGR
+	case 4:
+		return ModeBGRA
+	default:
+		return modeDefault
+	}
+}
+
+// GetTypeColorMode returns color mode type. It returns modeDefault when the
+// string is not supported.
+func GetTypeColorMode(str string) TypeColorMode {
+	switch str {
+	case "BGR":
+		return ModeBGR
+	case "RGB":
+		return ModeRGB
+	case "BGRA":
+		return ModeBGRA
+	case "RGBA":
+		return ModeRGBA
+	case "GRAY":
+		return ModeGRAY
+	default:
+		return modeDefault
+	}
+}
+
+// cvtColorCodes maps pairs of source and destination modes to OpenCV color
+// conversion codes.
+var cvtColorCodes = map[[2]TypeColorMode]int{
+	{ModeBGR, ModeRGB}:   bridge.CvBGR2RGB,
+	{ModeBGR, ModeBGRA}:  bridge.CvBGR2BGRA,
+	{ModeBGR, ModeRGBA}:  bridge.CvBGR2RGBA,
+	{ModeBGR, ModeGRAY}:  bridge.CvBGR2GRAY,
+	{ModeRGB, ModeBGR}:   bridge.CvRGB2BGR,
+	{ModeRGB, ModeBGRA}:  bridge.CvRGB2BGRA,
+	{ModeRGB, ModeRGBA}:  bridge.CvRGB2RGBA,
+	{ModeRGB, ModeGRAY}:  bridge.CvRGB2GRAY,
+	{ModeBGRA, ModeBGR}:  bridge.CvBGRA2BGR,
+	{ModeBGRA, ModeRGB}:  bridge.CvBGRA2RGB,
+	{ModeBGRA, ModeRGBA}: bridge.CvBGRA2RGBA,
+	{ModeBGRA, ModeGRAY}: bridge.CvBGRA2GRAY,
+	{ModeRGBA, ModeBGR}:  bridge.CvRGBA2BGR,
+	{ModeRGBA, ModeRGB}:  bridge.CvRGBA2RGB,
+	{ModeRGBA, ModeBGRA}: bridge.CvRGBA2BGRA,
+	{ModeRGBA, ModeGRAY}: bridge.CvRGBA2GRAY,
+	{ModeGRAY, ModeBGR}:  bridge.CvGRAY2BGR,
+	{ModeGRAY, ModeRGB}:  bridge.CvGRAY2RGB,
+	{ModeGRAY, ModeBGRA}: bridge.CvGRAY2BGRA,
+	{ModeGRAY, ModeRGBA}: bridge.CvGRAY2RGBA,
+}
+
 // RawData is represented of `cv::Mat_<cv::Vec3b>` structure.
 type RawData struct {
 	Format TypeImageFormat
 	Width  int
 	Height int
 	Data   []byte
+	// Channels is the number of channels of TypeCVMATF32. Other formats
+	// ignore it because the format decides the number.
+	Channels int
+	// Mode is the channel order of raw formats. The zero value means the
+	// default order of the number of channels, BGR, BGRA or GRAY. Encoded
+	// formats ignore it because they are always decoded as BGR.
+	Mode TypeColorMode
+}
+
+// mode returns the channel order of the raw format, or modeDefault when the
+// format is encoded or has no color mode.
+func (r *RawData) mode() TypeColorMode {
+	if r.Format.depth() < 0 {
+		return modeDefault
+	}
+	if r.Mode != modeDefault {
+		return r.Mode
+	}
+	return defaultColorMode(r.channels())
+}
+
+// ConvertColor returns RawData converted to the color mode. Encoded formats
+// are decoded before the conversion, and the returned RawData has a raw
+// format which has the same depth as the original.
+func (r *RawData) ConvertColor(mode TypeColorMode) (RawData, error) {
+	if mode.channels() == 0 {
+		return RawData{}, fmt.Errorf("'%v' color mode is not supported", mode)
+	}
+	src := r.mode()
+	if src == mode {
+		return *r, nil
+	}
+	mat, err := r.ToMat()
+	if err != nil {
+		return RawData{}, err
+	}
+	defer mat.Delete()
+	if src == modeDefault { // encoded formats
+		src = defaultColorMode(mat.Channels())
+	}
+	if src == mode {
+		return ToRawDataFromMat(mat)
+	}
+	code, ok := cvtColorCodes[[2]TypeColorMode{src, mode}]
+	if !ok {
+		return RawData{}, fmt.Errorf("cannot convert '%v' to '%v'", src, mode)
+	}
+	conv := mat.CvtColor(code)
+	defer conv.Delete()
+	ret, err := ToRawDataFromMat(conv)
+	if err != nil {
+		return RawData{}, err
+	}
+	if mode != defaultColorMode(ret.channels()) {
+		ret.Mode = mode
+	}
+	return ret, nil
+}
+
+// channels returns the number of channels of the raw format, or 0 when the
+// format is encoded.
+func (r *RawData) channels() int {
+	switch r.Format {
+	case TypeCVMAT:
+		return 3
+	case TypeCVMAT4b:
+		return 4
+	case TypeCVMATGray:
+		return 1
+	case TypeCVMATF32:
+		if r.Channels <= 0 {
+			return 1
+		}
+		return r.Channels
+	default:
+		return 0
+	}
+}
+
+// checkDataSize returns an error when the size of the image binary does not
+// match the width and height of pixels of elemSize bytes. The binary is read
+// by OpenCV with the size, so it must be checked before passed to bridge.
+func (r *RawData) checkDataSize(elemSize int) error {
+	if r.Width < 0 || r.Height < 0 ||
+		len(r.Data) != r.Width*r.Height*elemSize {
+		return fmt.Errorf(
+			"image size %v does not match %vx%v '%v' with %v channels",
+			len(r.Data), r.Width, r.Height, r.Format, r.channels())
+	}
+	return nil
+}
+
+// ToMat converts RawData to Mat. Returned Mat is required to delete after
+// using. Encoded formats are decoded to 3 channels Mat.
+func (r *RawData) ToMat() (bridge.Mat, error) {
+	depth := r.Format.depth()
+	if depth < 0 {
+		mat, err := r.ToMatVec3b()
+		if err != nil {
+			return bridge.Mat{}, err
+		}
+		defer mat.Delete()
+		return mat.ToMat(), nil
+	}
+	t := bridge.CvMakeType(depth, r.channels())
+	elemSize := r.channels()
+	if depth == bridge.CvDepth32F {
+		elemSize *= 4
+	}
+	if err := r.checkDataSize(elemSize); err != nil {
+		return bridge.Mat{}, err
+	}
+	return bridge.NewMatWithData(r.Height, r.Width, t, r.Data), nil
+}
+
+// ToRawDataFromMat converts Mat to RawData. The format is decided by the type
+// of Mat, 8-bit 1, 3 and 4 channels or 32-bit float are supported.
+func ToRawDataFromMat(m bridge.Mat) (RawData, error) {
+	if m.Empty() {
+		return RawData{}, fmt.Errorf("Mat is empty")
+	}
+	raw := RawData{
+		Width:  m.Cols(),
+		Height: m.Rows(),
+	}
+	switch bridge.CvMatDepth(m.Type()) {
+	case bridge.CvDepth8U:
+		switch m.Channels() {
+		case 1:
+			raw.Format = TypeCVMATGray
+		case 3:
+			raw.Format = TypeCVMAT
+		case 4:
+			raw.Format = TypeCVMAT4b
+		}
+	case bridge.CvDepth32F:
+		raw.Format = TypeCVMATF32
+		raw.Channels = m.Channels()
+	}
+	if raw.Format == typeUnknownFormat {
+		return RawData{}, fmt.Errorf("Mat type %v is not supported", m.Type())
+	}
+	raw.Data = m.ToBytes()
+	return raw, nil
 }
 
 // ToRawData converts MatVec3b to RawData.
@@ -72,24 +397,159 @@ func ToRawData(m bridge.MatVec3b) RawData {
 	}
 }
 
+// ToRawDataWithFormat converts MatVec3b to RawData of the format. Encoded
+// formats such as JPEG are encoded with the default quality of OpenCV.
+func ToRawDataWithFormat(m bridge.MatVec3b, format TypeImageFormat) (RawData,
+	error) {
+	switch format {
+	case TypeCVMAT:
+		return ToRawData(m), nil
+	case TypeCVMAT4b:
+		m4 := m.ToMatVec4b()
+		defer m4.Delete()
+		w, h, b := m4.ToRawData()
+		return RawData{
+			Format: TypeCVMAT4b,
+			Width:  w,
+			Height: h,
+			Data:   b,
+		}, nil
+	case TypeCVMATGray, TypeCVMATF32:
+		mat := m.ToMat()
+		defer mat.Delete()
+		var conv bridge.Mat
+		if format == TypeCVMATGray {
+			conv = mat.CvtColor(bridge.CvBGR2GRAY)
+		} else {
+			conv = mat.ConvertTo(bridge.CvMakeType(bridge.CvDepth32F, 3), 1, 0)
+		}
+		defer conv.Delete()
+		return ToRawDataFromMat(conv)
+	default:
+		return encodeMatVec3b(m, format, -1)
+	}
+}
+
+// toRawDataLike converts MatVec3b to RawData which has the same format and
+// color mode as the original RawData.
+func toRawDataLike(m bridge.MatVec3b, orig RawData) (RawData, error) {
+	ret, err := ToRawDataWithFormat(m, orig.Format)
+	if err != nil {
+		return RawData{}, err
+	}
+	if orig.Mode == modeDefault {
+		return ret, nil
+	}
+	return ret.ConvertColor(orig.Mode)
+}
+
+// toRawDataFromMatLike converts Mat to RawData which has the same format and
+// color mode as the original RawData. Encoded formats are encoded again with
+// the default quality.
+func toRawDataFromMatLike(m bridge.Mat, orig RawData) (RawData, error) {
+	ret, err := ToRawDataFromMat(m)
+	if err != nil {
+		return RawData{}, err
+	}
+	if orig.Format.depth() < 0 {
+		return ret.Encode(orig.Format, -1)
+	}
+	ret.Mode = orig.Mode
+	return ret, nil
+}
+
 // ToMatVec3b converts RawData to MatVec3b. Returned MatVec3b is required to
-// delete after using.
+// delete after using. When the format is TypeCVMAT, the MatVec3b shares the
+// data with RawData. Other formats are converted, an alpha channel of
+// TypeCVMAT4b is dropped, TypeCVMATGray is expanded to 3 channels and encoded
+// formats such as JPEG are decoded. RGB and RGBA images are converted to BGR.
+// TypeCVMATF32 cannot be converted.
 func (r *RawData) ToMatVec3b() (bridge.MatVec3b, error) {
-	if r.Format != TypeCVMAT {
+	if m := r.mode(); m == ModeRGB || m == ModeRGBA {
+		bgr, err := r.ConvertColor(ModeBGR)
+		if err != nil {
+			return bridge.MatVec3b{}, err
+		}
+		return bgr.ToMatVec3b()
+	}
+	switch {
+	case r.Format == TypeCVMAT:
+		if err := r.checkDataSize(3); err != nil {
+			return bridge.MatVec3b{}, err
+		}
+		return bridge.ToMatVec3b(r.Width, r.Height, r.Data), nil
+	case r.Format == TypeCVMAT4b:
+		if err := r.checkDataSize(4); err != nil {
+			return bridge.MatVec3b{}, err
+		}
+		m4 := bridge.ToMatVec4b(r.Width, r.Height, r.Data)
+		defer m4.Delete()
+		return m4.ToMatVec3b(), nil
+	case r.Format == TypeCVMATGray:
+		mat, err := r.ToMat()
+		if err != nil {
+			return bridge.MatVec3b{}, err
+		}
+		defer mat.Delete()
+		m3, _ := mat.ToMatVec3b() // CV_8UC1 is always supported
+		return m3, nil
+	case r.Format.extension() != "":
+		mat := bridge.DecodeToMatVec3b(r.Data)
+		if mat.Empty() {
+			mat.Delete()
+			return bridge.MatVec3b{}, fmt.Errorf("cannot decode image as '%v'",
+				r.Format)
+		}
+		return mat, nil
+	default:
 		return bridge.MatVec3b{}, fmt.Errorf("'%v' cannot convert to 'MatVec3b'",
 			r.Format)
 	}
-	return bridge.ToMatVec3b(r.Width, r.Height, r.Data), nil
 }
 
-func toRawMap(m *bridge.MatVec3b) data.Map {
-	r := ToRawData(*m)
-	return data.Map{
-		"format": data.String(r.Format.String()), // = cv::Mat_<cv::Vec3b> = "cvmat"
-		"width":  data.Int(r.Width),
-		"height": data.Int(r.Height),
-		"image":  data.Blob(r.Data),
+func toRawMap(m *bridge.MatVec3b) (data.Map, error) {
+	r := ToRawData(*m) // = cv::Mat_<cv::Vec3b> = "cvmat"
+	return r.ConvertToDataMap(), nil
+}
+
+func toEncodedMap(m *bridge.MatVec3b, format TypeImageFormat, quality int) (
+	data.Map, error) {
+	r, err := encodeMatVec3b(*m, format, quality)
+	if err != nil {
+		return nil, err
+	}
+	return r.ConvertToDataMap(), nil
+}
+
+// encodeMatVec3b encodes MatVec3b to the format. quality is used by JPEG and
+// WebP, and ignored by lossless formats. A negative quality means the default
+// of OpenCV.
+func encodeMatVec3b(m bridge.MatVec3b, format TypeImageFormat, quality int) (
+	RawData, error) {
+	ext := format.extension()
+	if ext == "" {
+		return RawData{}, fmt.Errorf("'%v' is not an encoded format", format)
+	}
+	var params []int
+	if quality >= 0 {
+		switch format {
+		case TypeJPEG:
+			params = []int{bridge.CvImwriteJpegQuality, quality}
+		case TypeWebP:
+			params = []int{bridge.CvImwriteWebpQuality, quality}
+		}
+	}
+	b, ok := m.Encode(ext, params)
+	if !ok {
+		return RawData{}, fmt.Errorf("cannot encode image to '%v'", format)
 	}
+	w, h := m.Size()
+	return RawData{
+		Format: format,
+		Width:  w,
+		Height: h,
+		Data:   b,
+	}, nil
 }
 
 // ConvertMapToRawData returns RawData from data.Map. This function is
@@ -128,50 +588,117 @@ func ConvertMapToRawData(dm data.Map) (RawData, error) {
 		}
 	}
 
-	return RawData{
+	raw := RawData{
 		Format: format,
 		Width:  int(width),
 		Height: int(height),
 		Data:   img,
-	}, nil
+	}
+
+	// "channels" and "depth" are optional, they are only validated when
+	// given because only cvmat_f32 can have variable number of channels.
+	if c, err := dm.Get(channelsPath); err == nil {
+		channels, err := data.AsInt(c)
+		if err != nil {
+			return RawData{}, err
+		}
+		if format == TypeCVMATF32 {
+			if channels <= 0 {
+				return RawData{}, fmt.Errorf("channels must be greater than 0: %v",
+					channels)
+			}
+			raw.Channels = int(channels)
+		} else if expected := raw.channels(); int(channels) != expected {
+			return RawData{}, fmt.Errorf("'%v' must have %v channels: %v",
+				format, expected, channels)
+		}
+	}
+	if d, err := dm.Get(depthPath); err == nil {
+		depth, err := data.AsString(d)
+		if err != nil {
+			return RawData{}, err
+		}
+		if expected := depthString(format.depth()); depth != expected {
+			return RawData{}, fmt.Errorf("'%v' must have depth '%v': %v",
+				format, expected, depth)
+		}
+	}
+	// "mode" is ignored by encoded formats, which are always decoded as BGR.
+	if m, err := dm.Get(modePath); err == nil && format.depth() >= 0 {
+		modeStr, err := data.AsString(m)
+		if err != nil {
+			return RawData{}, err
+		}
+		mode := GetTypeColorMode(modeStr)
+		if mode == modeDefault {
+			return RawData{}, fmt.Errorf("'%v' color mode is not supported",
+				modeStr)
+		}
+		if mode.channels() != raw.channels() {
+			return RawData{}, fmt.Errorf("'%v' color mode requires %v channels: %v",
+				mode, mode.channels(), raw.channels())
+		}
+		if mode != defaultColorMode(raw.channels()) {
+			raw.Mode = mode
+		}
+	}
+	return raw, nil
 }
 
 // ConvertToDataMap returns data.map. This function is utility method for
-// other plug-in.
+// other plug-in. Raw formats also have "channels", "depth" and "mode" fields.
 func (r *RawData) ConvertToDataMap() data.Map {
-	return data.Map{
+	m := data.Map{
 		"format": data.String(r.Format.String()),
 		"width":  data.Int(r.Width),
 		"height": data.Int(r.Height),
 		"image":  data.Blob(r.Data),
 	}
+	if depth := r.Format.depth(); depth >= 0 {
+		m["channels"] = data.Int(r.channels())
+		m["depth"] = data.String(depthString(depth))
+		if mode := r.mode(); mode != modeDefault {
+			m["mode"] = data.String(mode.String())
+		}
+	}
+	return m
 }
 
-// ToJpegData convert JPGE format image bytes.
-func (r *RawData) ToJpegData(quality int) ([]byte, error) {
-	if r.Format == TypeJPEG {
-		return r.Data, nil
-	}
-	// BGR to RGB
-	rgba := image.NewRGBA(image.Rect(0, 0, r.Width, r.Height))
-	if r.Format == TypeCVMAT {
-		for i, j := 0, 0; i < len(rgba.Pix); i, j = i+4, j+3 {
-			rgba.Pix[i+0] = r.Data[j+2]
-			rgba.Pix[i+1] = r.Data[j+1]
-			rgba.Pix[i+2] = r.Data[j+0]
-			rgba.Pix[i+3] = 0xFF
-		}
-	} else if r.Format == TypeCVMAT4b {
-		for i, j := 0, 0; i < len(rgba.Pix); i, j = i+4, j+3 {
-			rgba.Pix[i+0] = r.Data[j+2]
-			rgba.Pix[i+1] = r.Data[j+1]
-			rgba.Pix[i+2] = r.Data[j+0]
-			rgba.Pix[i+3] = r.Data[j+3]
-		}
-	} else {
-		return []byte{}, fmt.Errorf("'%v' cannot convert to JPEG", r.Format)
+// Encode returns RawData encoded to the format, such as TypeJPEG or TypePNG.
+// quality is used by JPEG and WebP from 0 to 100, and ignored by lossless
+// formats. A negative quality means the default of OpenCV. RawData of the
+// format is returned as it is when quality is negative, otherwise it is
+// encoded again with the quality.
+func (r *RawData) Encode(format TypeImageFormat, quality int) (RawData, error) {
+	if r.Format == format && quality < 0 {
+		return *r, nil
+	}
+	mat, err := r.ToMatVec3b()
+	if err != nil {
+		return RawData{}, err
 	}
-	w := bytes.NewBuffer([]byte{})
-	err := jpeg.Encode(w, rgba, &jpeg.Options{Quality: quality})
-	return w.Bytes(), err
+	defer mat.Delete()
+	return encodeMatVec3b(mat, format, quality)
+}
+
+// Decode returns RawData decoded to TypeCVMAT from other formats, such as
+// TypeJPEG or TypePNG. TypeCVMAT in other color modes than BGR, e.g. RGB, is
+// converted to BGR.
+func (r *RawData) Decode() (RawData, error) {
+	if r.Format == TypeCVMAT && r.mode() == ModeBGR {
+		return *r, nil
+	}
+	mat, err := r.ToMatVec3b()
+	if err != nil {
+		return RawData{}, err
+	}
+	defer mat.Delete()
+	return ToRawData(mat), nil
+}
+
+// ToJpegData convert JPGE format image bytes. All formats supported by
+// Encode are accepted, and the color mode of the image is respected.
+func (r *RawData) ToJpegData(quality int) ([]byte, error) {
+	enc, err := r.Encode(TypeJPEG, quality)
+	return enc.Data, err
 }
@@ -0,0 +1,421 @@
+package opencv
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"image/jpeg"
+	"testing"
+)
+
+func testRawData(width, height int) RawData {
+	raw := RawData{
+		Format: TypeCVMAT,
+		Width:  width,
+		Height: height,
+		Data:   make([]byte, width*height*3),
+	}
+	for i := range raw.Data {
+		raw.Data[i] = byte(i * 7)
+	}
+	return raw
+}
+
+func TestRawDataEncode(t *testing.T) {
+	Convey("Given a cvmat RawData", t, func() {
+		raw := testRawData(32, 24)
+
+		for _, f := range []TypeImageFormat{TypePNG, TypeBMP} {
+			f := f
+			Convey("When encode to lossless format "+f.String(), func() {
+				enc, err := raw.Encode(f, -1)
+				So(err, ShouldBeNil)
+				Convey("Then decoded image should be same as the original", func() {
+					So(enc.Format, ShouldEqual, f)
+					So(enc.Width, ShouldEqual, 32)
+					So(enc.Height, ShouldEqual, 24)
+					dec, err := enc.Decode()
+					So(err, ShouldBeNil)
+					So(dec, ShouldResemble, raw)
+				})
+			})
+		}
+
+		Convey("When encode to JPEG", func() {
+			enc, err := raw.Encode(TypeJPEG, 50)
+			So(err, ShouldBeNil)
+			Convey("Then decoded image should have the same size", func() {
+				So(enc.Format, ShouldEqual, TypeJPEG)
+				dec, err := enc.Decode()
+				So(err, ShouldBeNil)
+				So(dec.Format, ShouldEqual, TypeCVMAT)
+				So(dec.Width, ShouldEqual, 32)
+				So(dec.Height, ShouldEqual, 24)
+				So(len(dec.Data), ShouldEqual, len(raw.Data))
+			})
+			Convey("Then encoded image can be recompressed with another quality", func() {
+				low, err := enc.Encode(TypeJPEG, 10)
+				So(err, ShouldBeNil)
+				So(low.Format, ShouldEqual, TypeJPEG)
+				So(len(low.Data), ShouldBeLessThan, len(enc.Data))
+				same, err := enc.Encode(TypeJPEG, -1)
+				So(err, ShouldBeNil)
+				So(same, ShouldResemble, enc)
+			})
+			Convey("Then encoded image can be converted to another format", func() {
+				png, err := enc.Encode(TypePNG, -1)
+				So(err, ShouldBeNil)
+				So(png.Format, ShouldEqual, TypePNG)
+			})
+		})
+
+		Convey("When encode to not encoded format", func() {
+			_, err := raw.Encode(TypeCVMAT4b, -1)
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRawDataDecode(t *testing.T) {
+	Convey("Given a RawData which has broken PNG data", t, func() {
+		raw := RawData{
+			Format: TypePNG,
+			Width:  32,
+			Height: 24,
+			Data:   []byte("not a png"),
+		}
+		Convey("When decode it", func() {
+			_, err := raw.Decode()
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a cvmat4b RawData", t, func() {
+		raw := RawData{
+			Format: TypeCVMAT4b,
+			Width:  2,
+			Height: 2,
+			Data: []byte{
+				1, 2, 3, 255, 4, 5, 6, 255,
+				7, 8, 9, 255, 10, 11, 12, 255,
+			},
+		}
+		Convey("When decode it", func() {
+			dec, err := raw.Decode()
+			Convey("Then alpha channel should be dropped", func() {
+				So(err, ShouldBeNil)
+				So(dec, ShouldResemble, RawData{
+					Format: TypeCVMAT,
+					Width:  2,
+					Height: 2,
+					Data:   []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+				})
+			})
+		})
+		Convey("When convert to MatVec3b and back to cvmat4b", func() {
+			mat, err := raw.ToMatVec3b()
+			So(err, ShouldBeNil)
+			defer mat.Delete()
+			ret, err := ToRawDataWithFormat(mat, TypeCVMAT4b)
+			Convey("Then the image should be same as the original", func() {
+				So(err, ShouldBeNil)
+				So(ret, ShouldResemble, raw)
+			})
+		})
+	})
+
+	Convey("Given a RawData of unknown format", t, func() {
+		raw := RawData{
+			Width:  2,
+			Height: 2,
+			Data:   make([]byte, 2*2*3),
+		}
+		Convey("When decode it", func() {
+			_, err := raw.Decode()
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRawDataMat(t *testing.T) {
+	Convey("Given a cvmat RawData", t, func() {
+		raw := testRawData(4, 3)
+		mat, err := raw.ToMatVec3b()
+		So(err, ShouldBeNil)
+		defer mat.Delete()
+
+		Convey("When convert it to cvmat_gray", func() {
+			gray, err := ToRawDataWithFormat(mat, TypeCVMATGray)
+			So(err, ShouldBeNil)
+			Convey("Then the image should have 1 channel", func() {
+				So(gray.Format, ShouldEqual, TypeCVMATGray)
+				So(gray.Width, ShouldEqual, 4)
+				So(gray.Height, ShouldEqual, 3)
+				So(len(gray.Data), ShouldEqual, 4*3)
+			})
+			Convey("Then the image can be expanded to cvmat", func() {
+				m3, err := gray.ToMatVec3b()
+				So(err, ShouldBeNil)
+				defer m3.Delete()
+				w, h := m3.Size()
+				So(w, ShouldEqual, 4)
+				So(h, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When convert it to cvmat_f32", func() {
+			f32, err := ToRawDataWithFormat(mat, TypeCVMATF32)
+			So(err, ShouldBeNil)
+			Convey("Then the image should have float 3 channels", func() {
+				So(f32.Format, ShouldEqual, TypeCVMATF32)
+				So(f32.Channels, ShouldEqual, 3)
+				So(len(f32.Data), ShouldEqual, 4*3*3*4)
+			})
+			Convey("Then the image can be converted to Mat and back", func() {
+				m, err := f32.ToMat()
+				So(err, ShouldBeNil)
+				defer m.Delete()
+				So(m.Channels(), ShouldEqual, 3)
+				ret, err := ToRawDataFromMat(m)
+				So(err, ShouldBeNil)
+				So(ret, ShouldResemble, f32)
+			})
+			Convey("Then the image cannot be converted to MatVec3b", func() {
+				_, err := f32.ToMatVec3b()
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the data size does not match the format", func() {
+			raw.Format = TypeCVMATGray
+			_, err := raw.ToMat()
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the data is shorter than the size", func() {
+			short := raw
+			short.Data = raw.Data[:len(raw.Data)-1]
+			short4b := RawData{
+				Format: TypeCVMAT4b,
+				Width:  4,
+				Height: 3,
+				Data:   make([]byte, 4*3*3),
+			}
+			Convey("Then an error should occur", func() {
+				for _, r := range []RawData{short, short4b} {
+					_, err := r.ToMatVec3b()
+					So(err, ShouldNotBeNil)
+					_, err = r.ToMat()
+					So(err, ShouldNotBeNil)
+				}
+				_, err := DrawLine(short.ConvertToDataMap(), testPoint(0, 0),
+					testPoint(1, 1))
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRawDataMapChannels(t *testing.T) {
+	Convey("Given a cvmat_f32 RawData", t, func() {
+		raw := RawData{
+			Format:   TypeCVMATF32,
+			Width:    2,
+			Height:   1,
+			Data:     make([]byte, 2*1*2*4),
+			Channels: 2,
+		}
+
+		Convey("When convert it to a map", func() {
+			m := raw.ConvertToDataMap()
+			Convey("Then the map should have channels and depth", func() {
+				So(m["channels"], ShouldEqual, data.Int(2))
+				So(m["depth"], ShouldEqual, data.String("32f"))
+			})
+			Convey("Then the map can be converted back", func() {
+				ret, err := ConvertMapToRawData(m)
+				So(err, ShouldBeNil)
+				So(ret, ShouldResemble, raw)
+			})
+		})
+
+		Convey("When convert a map without channels", func() {
+			m := raw.ConvertToDataMap()
+			delete(m, "channels")
+			ret, err := ConvertMapToRawData(m)
+			Convey("Then the image should have 1 channel", func() {
+				So(err, ShouldBeNil)
+				So(ret.Channels, ShouldEqual, 0)
+				So(ret.channels(), ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given a map of JPEG", t, func() {
+		raw := testRawData(2, 2)
+		jpg, err := raw.Encode(TypeJPEG, -1)
+		So(err, ShouldBeNil)
+		m := jpg.ConvertToDataMap()
+		Convey("Then the map should not have channels and depth", func() {
+			_, ok := m["channels"]
+			So(ok, ShouldBeFalse)
+			_, ok = m["depth"]
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a map of cvmat", t, func() {
+		raw := testRawData(2, 2)
+		m := raw.ConvertToDataMap()
+		So(m["channels"], ShouldEqual, data.Int(3))
+		So(m["depth"], ShouldEqual, data.String("8u"))
+
+		Convey("When the map has invalid channels or depth", func() {
+			Convey("Then an error should occur", func() {
+				m["channels"] = data.Int(1)
+				_, err := ConvertMapToRawData(m)
+				So(err, ShouldNotBeNil)
+
+				m["channels"] = data.Int(3)
+				m["depth"] = data.String("32f")
+				_, err = ConvertMapToRawData(m)
+				So(err, ShouldNotBeNil)
+
+				m["depth"] = data.Int(8)
+				_, err = ConvertMapToRawData(m)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRawDataColorMode(t *testing.T) {
+	Convey("Given a 1x1 cvmat RawData", t, func() {
+		raw := RawData{
+			Format: TypeCVMAT,
+			Width:  1,
+			Height: 1,
+			Data:   []byte{1, 2, 3},
+		}
+
+		Convey("When convert it to RGB", func() {
+			rgb, err := raw.ConvertColor(ModeRGB)
+			So(err, ShouldBeNil)
+			Convey("Then the channels should be swapped", func() {
+				So(rgb, ShouldResemble, RawData{
+					Format: TypeCVMAT,
+					Width:  1,
+					Height: 1,
+					Data:   []byte{3, 2, 1},
+					Mode:   ModeRGB,
+				})
+			})
+			Convey("Then the map should have the mode", func() {
+				m := rgb.ConvertToDataMap()
+				So(m["mode"], ShouldEqual, data.String("RGB"))
+				ret, err := ConvertMapToRawData(m)
+				So(err, ShouldBeNil)
+				So(ret, ShouldResemble, rgb)
+			})
+			Convey("Then it should be converted to BGR MatVec3b", func() {
+				mat, err := rgb.ToMatVec3b()
+				So(err, ShouldBeNil)
+				defer mat.Delete()
+				So(ToRawData(mat), ShouldResemble, raw)
+			})
+		})
+
+		Convey("When convert it to RGBA", func() {
+			rgba, err := raw.ConvertColor(ModeRGBA)
+			Convey("Then the image should be cvmat4b", func() {
+				So(err, ShouldBeNil)
+				So(rgba.Format, ShouldEqual, TypeCVMAT4b)
+				So(rgba.Mode, ShouldEqual, ModeRGBA)
+				So(rgba.Data, ShouldResemble, []byte{3, 2, 1, 255})
+			})
+		})
+
+		Convey("When convert it to GRAY", func() {
+			gray, err := raw.ConvertColor(ModeGRAY)
+			Convey("Then the image should be cvmat_gray", func() {
+				So(err, ShouldBeNil)
+				So(gray.Format, ShouldEqual, TypeCVMATGray)
+				So(gray.Mode, ShouldEqual, modeDefault)
+				So(gray.ConvertToDataMap()["mode"], ShouldEqual, data.String("GRAY"))
+			})
+		})
+
+		Convey("When convert it to BGR", func() {
+			ret, err := raw.ConvertColor(ModeBGR)
+			Convey("Then the image should be returned as it is", func() {
+				So(err, ShouldBeNil)
+				So(ret, ShouldResemble, raw)
+			})
+		})
+
+		Convey("When a map has invalid mode", func() {
+			m := raw.ConvertToDataMap()
+			Convey("Then an error should occur", func() {
+				m["mode"] = data.String("RGBA")
+				_, err := ConvertMapToRawData(m)
+				So(err, ShouldNotBeNil)
+
+				m["mode"] = data.String("HSV")
+				_, err = ConvertMapToRawData(m)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRawDataToJpegData(t *testing.T) {
+	Convey("Given a red cvmat RawData in RGB mode", t, func() {
+		bgr := RawData{
+			Format: TypeCVMAT,
+			Width:  8,
+			Height: 8,
+			Data:   make([]byte, 8*8*3),
+		}
+		for i := 0; i < len(bgr.Data); i += 3 {
+			bgr.Data[i+2] = 255 // red
+		}
+		rgb, err := bgr.ConvertColor(ModeRGB)
+		So(err, ShouldBeNil)
+
+		Convey("When convert it to JPEG", func() {
+			b, err := rgb.ToJpegData(95)
+			So(err, ShouldBeNil)
+			Convey("Then the decoded image should be red", func() {
+				img, err := jpeg.Decode(bytes.NewReader(b))
+				So(err, ShouldBeNil)
+				r, g, bl, _ := img.At(4, 4).RGBA()
+				So(r>>8, ShouldBeGreaterThan, 200)
+				So(g>>8, ShouldBeLessThan, 50)
+				So(bl>>8, ShouldBeLessThan, 50)
+			})
+		})
+
+		Convey("When convert other formats to JPEG", func() {
+			gray, err := bgr.ConvertColor(ModeGRAY)
+			So(err, ShouldBeNil)
+			png, err := bgr.Encode(TypePNG, -1)
+			So(err, ShouldBeNil)
+			Convey("Then they should be encoded", func() {
+				for _, r := range []RawData{gray, png} {
+					b, err := r.ToJpegData(80)
+					So(err, ShouldBeNil)
+					_, err = jpeg.Decode(bytes.NewReader(b))
+					So(err, ShouldBeNil)
+				}
+			})
+		})
+	})
+}
@@ -0,0 +1,551 @@
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"math"
+)
+
+var (
+	scalePath         = data.MustCompilePath("scale")
+	interpolationPath = data.MustCompilePath("interpolation")
+	resizeModePath    = data.MustCompilePath("mode")
+	borderPath        = data.MustCompilePath("border")
+	typePath          = data.MustCompilePath("type")
+	anglePath         = data.MustCompilePath("angle")
+)
+
+// matTransform transforms a Mat to a new Mat. The returned Mat is required to
+// delete after using, and the given Mat is kept as it is.
+type matTransform func(m bridge.Mat) (bridge.Mat, error)
+
+// applyTransform applies the transform to the image, and returns the image
+// which has the same format and color mode as the original. The image is
+// required to structured as RawData.
+func applyTransform(img data.Map, t matTransform) (data.Map, error) {
+	raw, err := ConvertMapToRawData(img)
+	if err != nil {
+		return nil, err
+	}
+	mat, err := raw.ToMat()
+	if err != nil {
+		return nil, err
+	}
+	defer mat.Delete()
+
+	ret, err := t(mat)
+	if err != nil {
+		return nil, err
+	}
+	defer ret.Delete()
+	retRaw, err := toRawDataFromMatLike(ret, raw)
+	if err != nil {
+		return nil, err
+	}
+	return retRaw.ConvertToDataMap(), nil
+}
+
+var interpolations = map[string]int{
+	"nearest": bridge.CvInterNearest,
+	"linear":  bridge.CvInterLinear,
+	"cubic":   bridge.CvInterCubic,
+	"area":    bridge.CvInterArea,
+}
+
+// resizeMode decides how an image is resized when both width and height are
+// given.
+type resizeMode int
+
+const (
+	// resizeStretch resizes to the size ignoring the aspect ratio.
+	resizeStretch resizeMode = iota
+	// resizeFit resizes to fit in the size keeping the aspect ratio, the
+	// result can be smaller than the size.
+	resizeFit
+	// resizeFill resizes to cover the size keeping the aspect ratio, and
+	// crops the center of the size.
+	resizeFill
+	// resizeLetterbox resizes like resizeFit, and pads black borders to
+	// the size.
+	resizeLetterbox
+)
+
+var resizeModes = map[string]resizeMode{
+	"stretch":   resizeStretch,
+	"fit":       resizeFit,
+	"fill":      resizeFill,
+	"letterbox": resizeLetterbox,
+}
+
+type resizeParams struct {
+	width         int
+	height        int
+	scale         float64
+	interpolation int
+	mode          resizeMode
+}
+
+// newResizeTransform returns a transform which resizes images. See Resize
+// for params.
+func newResizeTransform(params data.Map) (matTransform, error) {
+	p := resizeParams{
+		interpolation: bridge.CvInterLinear,
+	}
+	if w, err := params.Get(widthPath); err == nil {
+		width, err := data.ToInt(w)
+		if err != nil {
+			return nil, err
+		}
+		if width <= 0 {
+			return nil, fmt.Errorf("width must be greater than 0: %v", width)
+		}
+		p.width = int(width)
+	}
+	if h, err := params.Get(heightPath); err == nil {
+		height, err := data.ToInt(h)
+		if err != nil {
+			return nil, err
+		}
+		if height <= 0 {
+			return nil, fmt.Errorf("height must be greater than 0: %v", height)
+		}
+		p.height = int(height)
+	}
+	if s, err := params.Get(scalePath); err == nil {
+		if p.scale, err = data.ToFloat(s); err != nil {
+			return nil, err
+		}
+		if p.scale <= 0 {
+			return nil, fmt.Errorf("scale must be greater than 0: %v", p.scale)
+		}
+		if p.width > 0 || p.height > 0 {
+			return nil, fmt.Errorf("scale cannot be used with width or height")
+		}
+	} else if p.width == 0 && p.height == 0 {
+		return nil, fmt.Errorf("width, height or scale is required")
+	}
+	if i, err := params.Get(interpolationPath); err == nil {
+		name, err := data.AsString(i)
+		if err != nil {
+			return nil, err
+		}
+		interpolation, ok := interpolations[name]
+		if !ok {
+			return nil, fmt.Errorf("'%v' interpolation is not supported", name)
+		}
+		p.interpolation = interpolation
+	}
+	if m, err := params.Get(resizeModePath); err == nil {
+		name, err := data.AsString(m)
+		if err != nil {
+			return nil, err
+		}
+		mode, ok := resizeModes[name]
+		if !ok {
+			return nil, fmt.Errorf("'%v' resize mode is not supported", name)
+		}
+		p.mode = mode
+	}
+	return p.resize, nil
+}
+
+func (p *resizeParams) resize(m bridge.Mat) (bridge.Mat, error) {
+	srcW, srcH := m.Cols(), m.Rows()
+	if srcW == 0 || srcH == 0 {
+		return bridge.Mat{}, fmt.Errorf("cannot resize an empty image")
+	}
+	scaled := func(v int, r float64) int {
+		ret := int(math.Floor(float64(v)*r + 0.5))
+		if ret < 1 {
+			return 1
+		}
+		return ret
+	}
+
+	switch {
+	case p.scale > 0:
+		return m.Resize(scaled(srcW, p.scale), scaled(srcH, p.scale),
+			p.interpolation), nil
+	case p.height == 0:
+		r := float64(p.width) / float64(srcW)
+		return m.Resize(p.width, scaled(srcH, r), p.interpolation), nil
+	case p.width == 0:
+		r := float64(p.height) / float64(srcH)
+		return m.Resize(scaled(srcW, r), p.height, p.interpolation), nil
+	}
+
+	rw := float64(p.width) / float64(srcW)
+	rh := float64(p.height) / float64(srcH)
+	switch p.mode {
+	case resizeFit, resizeLetterbox:
+		r := math.Min(rw, rh)
+		w, h := scaled(srcW, r), scaled(srcH, r)
+		if w > p.width {
+			w = p.width
+		}
+		if h > p.height {
+			h = p.height
+		}
+		resized := m.Resize(w, h, p.interpolation)
+		if p.mode == resizeFit {
+			return resized, nil
+		}
+		defer resized.Delete()
+		top, left := (p.height-h)/2, (p.width-w)/2
+		return resized.CopyMakeBorder(top, p.height-h-top, left, p.width-w-left,
+			bridge.CvBorderConstant), nil
+	case resizeFill:
+		r := math.Max(rw, rh)
+		w, h := scaled(srcW, r), scaled(srcH, r)
+		if w < p.width {
+			w = p.width
+		}
+		if h < p.height {
+			h = p.height
+		}
+		resized := m.Resize(w, h, p.interpolation)
+		defer resized.Delete()
+		return resized.Region(bridge.Rect{
+			X:      (w - p.width) / 2,
+			Y:      (h - p.height) / 2,
+			Width:  p.width,
+			Height: p.height,
+		}), nil
+	default:
+		return m.Resize(p.width, p.height, p.interpolation), nil
+	}
+}
+
+// Resize resizes the image. The image is required to structured as RawData,
+// and the returned image has the same format and color mode as the image.
+// Encoded images are encoded again with the default quality.
+//
+// params: A map of the parameters below.
+//
+// width, height: The size of the resized image. When only one of them is
+// given, the other is decided by the aspect ratio of the image.
+//
+// scale: The scale of the resized image, e.g. 0.5 is a half size. It cannot
+// be used with width and height.
+//
+// interpolation: The interpolation method, "nearest", "linear", "cubic" or
+// "area", default is "linear". "area" is suitable for shrinking.
+//
+// mode: How to resize when both width and height are given. "stretch"
+// ignores the aspect ratio, "fit" keeps the aspect ratio and fits in the
+// size, "fill" keeps the aspect ratio and crops the center to the size,
+// "letterbox" fits in the size and pads black borders. Default is "stretch".
+func Resize(img data.Map, params data.Map) (data.Map, error) {
+	t, err := newResizeTransform(params)
+	if err != nil {
+		return nil, err
+	}
+	return applyTransform(img, t)
+}
+
+// newCropTransform returns a transform which crops the rectangle. The
+// rectangle is clipped by the image.
+func newCropTransform(rect bridge.Rect) matTransform {
+	return func(m bridge.Mat) (bridge.Mat, error) {
+		ret := m.Region(rect)
+		if ret.Empty() {
+			ret.Delete()
+			return bridge.Mat{}, fmt.Errorf(
+				"rect %+v is out of the image of %vx%v", rect, m.Cols(), m.Rows())
+		}
+		return ret, nil
+	}
+}
+
+// Crop crops rectangles of the image, e.g. detected faces. The image is
+// required to structured as RawData, and the returned images have the same
+// format and color mode as the image. Rectangles are clipped by the image.
+//
+// rects: A rectangle map of "x", "y", "width" and "height", which is the
+// same as a result of DetectMultiScale, or an array of them. When an array is
+// given, an array of cropped images is returned.
+func Crop(img data.Map, rects data.Value) (data.Value, error) {
+	if rects.Type() == data.TypeMap {
+		brRects, err := convertToBridgeRects(data.Array{rects})
+		if err != nil {
+			return nil, err
+		}
+		return applyTransform(img, newCropTransform(brRects[0]))
+	}
+
+	a, err := data.AsArray(rects)
+	if err != nil {
+		return nil, err
+	}
+	brRects, err := convertToBridgeRects(a)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ConvertMapToRawData(img)
+	if err != nil {
+		return nil, err
+	}
+	mat, err := raw.ToMat()
+	if err != nil {
+		return nil, err
+	}
+	defer mat.Delete()
+
+	ret := make(data.Array, len(brRects))
+	for i, r := range brRects {
+		cropped, err := newCropTransform(r)(mat)
+		if err != nil {
+			return nil, err
+		}
+		retRaw, err := toRawDataFromMatLike(cropped, raw)
+		cropped.Delete()
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = retRaw.ConvertToDataMap()
+	}
+	return ret, nil
+}
+
+var flipCodes = map[string]int{
+	"vertical":   0,
+	"horizontal": 1,
+	"both":       -1,
+}
+
+// newFlipTransform returns a transform which flips images by the OpenCV flip
+// code.
+func newFlipTransform(flipCode int) matTransform {
+	return func(m bridge.Mat) (bridge.Mat, error) {
+		return m.Flip(flipCode), nil
+	}
+}
+
+// Flip flips the image. The image is required to structured as RawData, and
+// the returned image has the same format and color mode as the image.
+//
+// mode: "horizontal" mirrors the image left and right, "vertical" turns it
+// upside down, and "both" does both of them.
+func Flip(img data.Map, mode string) (data.Map, error) {
+	code, ok := flipCodes[mode]
+	if !ok {
+		return nil, fmt.Errorf("'%v' flip mode is not supported", mode)
+	}
+	return applyTransform(img, newFlipTransform(code))
+}
+
+func transposeTransform(m bridge.Mat) (bridge.Mat, error) {
+	return m.Transpose(), nil
+}
+
+// Transpose transposes the image, which swaps rows and columns. The image is
+// required to structured as RawData, and the returned image has the same
+// format and color mode as the image.
+func Transpose(img data.Map) (data.Map, error) {
+	return applyTransform(img, transposeTransform)
+}
+
+var borderTypes = map[string]int{
+	"constant":   bridge.CvBorderConstant,
+	"replicate":  bridge.CvBorderReplicate,
+	"reflect":    bridge.CvBorderReflect,
+	"wrap":       bridge.CvBorderWrap,
+	"reflect101": bridge.CvBorderReflect101,
+}
+
+// newRotateTransform returns a transform which rotates images
+// counterclockwise by the angle in degrees. Multiples of 90 degrees are
+// rotated exactly and change the size of images, and other angles keep the
+// size and fill the outside by the border type.
+func newRotateTransform(angle float64, borderType int) matTransform {
+	a := math.Mod(angle, 360)
+	if a < 0 {
+		a += 360
+	}
+	return func(m bridge.Mat) (bridge.Mat, error) {
+		switch a {
+		case 0:
+			return m.Region(bridge.Rect{Width: m.Cols(), Height: m.Rows()}), nil
+		case 90:
+			t := m.Transpose()
+			defer t.Delete()
+			return t.Flip(0), nil
+		case 180:
+			return m.Flip(-1), nil
+		case 270:
+			t := m.Transpose()
+			defer t.Delete()
+			return t.Flip(1), nil
+		default:
+			return m.Rotate(a, borderType), nil
+		}
+	}
+}
+
+// Rotate rotates the image counterclockwise by the angle in degrees, e.g. 90
+// or -90 for ceiling-mounted cameras. The image is required to structured as
+// RawData, and the returned image has the same format and color mode as the
+// image. Multiples of 90 degrees are rotated exactly and swap the width and
+// height for 90 and 270. Other angles keep the size of the image.
+//
+// params: An optional map of "border", which decides how the outside of the
+// original image is filled on arbitrary angles. "constant" (black),
+// "replicate", "reflect", "wrap" and "reflect101" are supported, default is
+// "constant".
+func Rotate(img data.Map, angle float64, params ...data.Map) (data.Map, error) {
+	if len(params) > 1 {
+		return nil, fmt.Errorf("too many arguments")
+	}
+	borderType := bridge.CvBorderConstant
+	if len(params) == 1 {
+		var err error
+		if borderType, err = toBorderType(params[0]); err != nil {
+			return nil, err
+		}
+	}
+	return applyTransform(img, newRotateTransform(angle, borderType))
+}
+
+func toBorderType(params data.Map) (int, error) {
+	b, err := params.Get(borderPath)
+	if err != nil {
+		return bridge.CvBorderConstant, nil
+	}
+	name, err := data.AsString(b)
+	if err != nil {
+		return 0, err
+	}
+	borderType, ok := borderTypes[name]
+	if !ok {
+		return 0, fmt.Errorf("'%v' border is not supported", name)
+	}
+	return borderType, nil
+}
+
+// grayscaleTransform converts images to grayscale. Grayscale images are
+// copied as they are.
+func grayscaleTransform(m bridge.Mat) (bridge.Mat, error) {
+	switch m.Channels() {
+	case 1:
+		return m.Region(bridge.Rect{Width: m.Cols(), Height: m.Rows()}), nil
+	case 3:
+		return m.CvtColor(bridge.CvBGR2GRAY), nil
+	case 4:
+		return m.CvtColor(bridge.CvBGRA2GRAY), nil
+	default:
+		return bridge.Mat{}, fmt.Errorf(
+			"image of %v channels cannot be converted to grayscale", m.Channels())
+	}
+}
+
+// chainTransforms returns a transform which applies the transforms in order.
+func chainTransforms(ts []matTransform) matTransform {
+	return func(m bridge.Mat) (bridge.Mat, error) {
+		if len(ts) == 0 {
+			return m.Region(bridge.Rect{Width: m.Cols(), Height: m.Rows()}), nil
+		}
+		cur := m
+		for i, t := range ts {
+			next, err := t(cur)
+			if i > 0 {
+				cur.Delete() // intermediate result
+			}
+			if err != nil {
+				return bridge.Mat{}, err
+			}
+			cur = next
+		}
+		return cur, nil
+	}
+}
+
+// newTransform returns a transform of the "type" of the map. The other keys
+// of the map are parameters of the transform.
+//
+// resize: The same parameters as Resize, e.g. {"type": "resize",
+// "width": 640, "height": 360, "mode": "letterbox"}.
+//
+// rotate: "angle" in degrees and optional "border" as Rotate, e.g.
+// {"type": "rotate", "angle": 90}.
+//
+// flip: "mode" as Flip, e.g. {"type": "flip", "mode": "horizontal"}.
+//
+// crop: A rectangle of "x", "y", "width" and "height".
+//
+// transpose, grayscale: No parameters.
+func newTransform(params data.Map) (matTransform, error) {
+	t, err := params.Get(typePath)
+	if err != nil {
+		return nil, fmt.Errorf("type of transform is required")
+	}
+	typ, err := data.AsString(t)
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ {
+	case "resize":
+		return newResizeTransform(params)
+	case "rotate":
+		a, err := params.Get(anglePath)
+		if err != nil {
+			return nil, fmt.Errorf("angle of rotate is required")
+		}
+		angle, err := data.ToFloat(a)
+		if err != nil {
+			return nil, err
+		}
+		borderType, err := toBorderType(params)
+		if err != nil {
+			return nil, err
+		}
+		return newRotateTransform(angle, borderType), nil
+	case "flip":
+		m, err := params.Get(resizeModePath)
+		if err != nil {
+			return nil, fmt.Errorf("mode of flip is required")
+		}
+		mode, err := data.AsString(m)
+		if err != nil {
+			return nil, err
+		}
+		code, ok := flipCodes[mode]
+		if !ok {
+			return nil, fmt.Errorf("'%v' flip mode is not supported", mode)
+		}
+		return newFlipTransform(code), nil
+	case "crop":
+		rects, err := convertToBridgeRects(data.Array{params})
+		if err != nil {
+			return nil, err
+		}
+		return newCropTransform(rects[0]), nil
+	case "transpose":
+		return transposeTransform, nil
+	case "grayscale":
+		return grayscaleTransform, nil
+	default:
+		return nil, fmt.Errorf("'%v' transform is not supported", typ)
+	}
+}
+
+// toTransforms converts an array of transform maps to a transform which
+// applies them in order. See newTransform for the maps.
+func toTransforms(v data.Value) (matTransform, error) {
+	a, err := data.AsArray(v)
+	if err != nil {
+		return nil, err
+	}
+	ts := make([]matTransform, len(a))
+	for i, e := range a {
+		m, err := data.AsMap(e)
+		if err != nil {
+			return nil, err
+		}
+		if ts[i], err = newTransform(m); err != nil {
+			return nil, fmt.Errorf("transforms[%v] is invalid: %v", i, err)
+		}
+	}
+	return chainTransforms(ts), nil
+}
@@ -0,0 +1,249 @@
+package opencv
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"testing"
+)
+
+func TestResize(t *testing.T) {
+	Convey("Given a 64x32 cvmat image", t, func() {
+		raw := testRawData(64, 32)
+		img := raw.ConvertToDataMap()
+		size := func(m data.Map) (int64, int64) {
+			w, _ := data.AsInt(m["width"])
+			h, _ := data.AsInt(m["height"])
+			return w, h
+		}
+
+		Convey("When resize it with each parameter", func() {
+			cases := []struct {
+				title  string
+				params data.Map
+				width  int64
+				height int64
+			}{
+				{"scale", data.Map{"scale": data.Float(0.5)}, 32, 16},
+				{"only width", data.Map{"width": data.Int(32)}, 32, 16},
+				{"only height", data.Map{"height": data.Int(64)}, 128, 64},
+				{"stretch", data.Map{"width": data.Int(20), "height": data.Int(20)},
+					20, 20},
+				{"fit", data.Map{"width": data.Int(20), "height": data.Int(20),
+					"mode": data.String("fit")}, 20, 10},
+				{"fill", data.Map{"width": data.Int(20), "height": data.Int(20),
+					"mode": data.String("fill")}, 20, 20},
+				{"letterbox", data.Map{"width": data.Int(20), "height": data.Int(20),
+					"mode":          data.String("letterbox"),
+					"interpolation": data.String("area")}, 20, 20},
+			}
+			for _, c := range cases {
+				c := c
+				Convey("Then the image should be resized with "+c.title, func() {
+					ret, err := Resize(img, c.params)
+					So(err, ShouldBeNil)
+					So(ret["format"], ShouldEqual, data.String("cvmat"))
+					w, h := size(ret)
+					So(w, ShouldEqual, c.width)
+					So(h, ShouldEqual, c.height)
+					b, _ := data.AsBlob(ret["image"])
+					So(len(b), ShouldEqual, c.width*c.height*3)
+				})
+			}
+		})
+
+		Convey("When resize it with letterbox mode", func() {
+			ret, err := Resize(img, data.Map{
+				"width":  data.Int(20),
+				"height": data.Int(20),
+				"mode":   data.String("letterbox"),
+			})
+			So(err, ShouldBeNil)
+			Convey("Then the top and bottom should be black", func() {
+				b, _ := data.AsBlob(ret["image"])
+				So(b[0:3], ShouldResemble, []byte{0, 0, 0})
+				last := len(b) - 3
+				So(b[last:], ShouldResemble, []byte{0, 0, 0})
+			})
+		})
+
+		Convey("When resize images of other formats", func() {
+			rgb, err := ConvertColor(img, "RGB")
+			So(err, ShouldBeNil)
+			gray, err := ConvertColor(img, "GRAY")
+			So(err, ShouldBeNil)
+			png, err := EncodeImage(img, "png")
+			So(err, ShouldBeNil)
+			Convey("Then the format and mode should be kept", func() {
+				for _, src := range []data.Map{rgb, gray, png} {
+					ret, err := Resize(src, data.Map{"scale": data.Float(0.5)})
+					So(err, ShouldBeNil)
+					So(ret["format"], ShouldEqual, src["format"])
+					So(ret["mode"], ShouldEqual, src["mode"])
+					w, h := size(ret)
+					So(w, ShouldEqual, 32)
+					So(h, ShouldEqual, 16)
+				}
+			})
+		})
+
+		Convey("When resize it with invalid parameters", func() {
+			Convey("Then an error should occur", func() {
+				testMaps := []data.Map{
+					{},
+					{"width": data.Int(0)},
+					{"height": data.Int(-1)},
+					{"scale": data.Float(0)},
+					{"scale": data.Float(0.5), "width": data.Int(10)},
+					{"width": data.Int(10), "interpolation": data.String("lanczos")},
+					{"width": data.Int(10), "mode": data.String("crop")},
+				}
+				for _, params := range testMaps {
+					_, err := Resize(img, params)
+					So(err, ShouldNotBeNil)
+				}
+			})
+		})
+	})
+}
+
+func TestCropFlipRotate(t *testing.T) {
+	Convey("Given a 2x2 cvmat image", t, func() {
+		raw := RawData{
+			Format: TypeCVMAT,
+			Width:  2,
+			Height: 2,
+			Data: []byte{
+				1, 1, 1, 2, 2, 2,
+				3, 3, 3, 4, 4, 4,
+			},
+		}
+		img := raw.ConvertToDataMap()
+		rect := func(x, y, w, h int) data.Map {
+			return data.Map{
+				"x":      data.Int(x),
+				"y":      data.Int(y),
+				"width":  data.Int(w),
+				"height": data.Int(h),
+			}
+		}
+
+		Convey("When crop a rect", func() {
+			ret, err := Crop(img, rect(1, 0, 1, 2))
+			So(err, ShouldBeNil)
+			Convey("Then the cropped image should be returned", func() {
+				m, err := data.AsMap(ret)
+				So(err, ShouldBeNil)
+				So(m["width"], ShouldEqual, data.Int(1))
+				So(m["height"], ShouldEqual, data.Int(2))
+				So(m["image"], ShouldResemble, data.Blob([]byte{2, 2, 2, 4, 4, 4}))
+			})
+		})
+
+		Convey("When crop an array of rects", func() {
+			ret, err := Crop(img, data.Array{rect(0, 0, 1, 1), rect(1, 1, 5, 5)})
+			So(err, ShouldBeNil)
+			Convey("Then an array of cropped images clipped by the image should be returned", func() {
+				a, err := data.AsArray(ret)
+				So(err, ShouldBeNil)
+				So(len(a), ShouldEqual, 2)
+				m0, _ := data.AsMap(a[0])
+				So(m0["image"], ShouldResemble, data.Blob([]byte{1, 1, 1}))
+				m1, _ := data.AsMap(a[1])
+				So(m1["image"], ShouldResemble, data.Blob([]byte{4, 4, 4}))
+			})
+		})
+
+		Convey("When crop a rect out of the image", func() {
+			_, err := Crop(img, rect(5, 5, 1, 1))
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When flip it", func() {
+			h, err := Flip(img, "horizontal")
+			So(err, ShouldBeNil)
+			v, err := Flip(img, "vertical")
+			So(err, ShouldBeNil)
+			Convey("Then the image should be mirrored", func() {
+				So(h["image"], ShouldResemble, data.Blob([]byte{
+					2, 2, 2, 1, 1, 1,
+					4, 4, 4, 3, 3, 3,
+				}))
+				So(v["image"], ShouldResemble, data.Blob([]byte{
+					3, 3, 3, 4, 4, 4,
+					1, 1, 1, 2, 2, 2,
+				}))
+			})
+			Convey("Then an unsupported mode should return an error", func() {
+				_, err := Flip(img, "diagonal")
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When transpose it", func() {
+			ret, err := Transpose(img)
+			So(err, ShouldBeNil)
+			Convey("Then rows and columns should be swapped", func() {
+				So(ret["image"], ShouldResemble, data.Blob([]byte{
+					1, 1, 1, 3, 3, 3,
+					2, 2, 2, 4, 4, 4,
+				}))
+			})
+		})
+
+		Convey("When rotate it by multiples of 90 degrees", func() {
+			r90, err := Rotate(img, 90)
+			So(err, ShouldBeNil)
+			r180, err := Rotate(img, 180)
+			So(err, ShouldBeNil)
+			r270, err := Rotate(img, -90)
+			So(err, ShouldBeNil)
+			Convey("Then the image should be rotated counterclockwise exactly", func() {
+				So(r90["image"], ShouldResemble, data.Blob([]byte{
+					2, 2, 2, 4, 4, 4,
+					1, 1, 1, 3, 3, 3,
+				}))
+				So(r180["image"], ShouldResemble, data.Blob([]byte{
+					4, 4, 4, 3, 3, 3,
+					2, 2, 2, 1, 1, 1,
+				}))
+				So(r270["image"], ShouldResemble, data.Blob([]byte{
+					3, 3, 3, 1, 1, 1,
+					4, 4, 4, 2, 2, 2,
+				}))
+			})
+		})
+	})
+
+	Convey("Given a 64x32 cvmat image", t, func() {
+		img := testRawData(64, 32).ConvertToDataMap()
+
+		Convey("When rotate it by an arbitrary angle", func() {
+			ret, err := Rotate(img, 30, data.Map{"border": data.String("replicate")})
+			So(err, ShouldBeNil)
+			Convey("Then the size should be kept", func() {
+				So(ret["width"], ShouldEqual, data.Int(64))
+				So(ret["height"], ShouldEqual, data.Int(32))
+			})
+		})
+
+		Convey("When rotate it by 90 degrees", func() {
+			ret, err := Rotate(img, 90)
+			So(err, ShouldBeNil)
+			Convey("Then the width and height should be swapped", func() {
+				So(ret["width"], ShouldEqual, data.Int(32))
+				So(ret["height"], ShouldEqual, data.Int(64))
+			})
+		})
+
+		Convey("When rotate it with invalid parameters", func() {
+			Convey("Then an error should occur", func() {
+				_, err := Rotate(img, 30, data.Map{"border": data.String("mirror")})
+				So(err, ShouldNotBeNil)
+				_, err = Rotate(img, 30, data.Map{}, data.Map{})
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
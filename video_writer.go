@@ -0,0 +1,385 @@
+package opencv
+
+import (
+	"fmt"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/bql"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VideoWriterCreator is a creator of a video writer sink.
+type VideoWriterCreator struct{}
+
+var (
+	codecPath           = data.MustCompilePath("codec")
+	timestampFormatPath = data.MustCompilePath("timestamp_format")
+	segmentDurationPath = data.MustCompilePath("segment_duration")
+	segmentFramesPath   = data.MustCompilePath("segment_frames")
+	maxSegmentsPath     = data.MustCompilePath("max_segments")
+)
+
+const (
+	fileNameTimestamp = "{timestamp}"
+	fileNameSequence  = "{seq}"
+)
+
+// CreateSink creates a video file writer using OpenCV video writer. Tuples
+// written to the sink are required to be structured as RawData map, such as
+// the output of capture sources.
+//
+// WITH parameters.
+//
+// file: [required] An output file path (e.g. /data/record.avi). When the
+// video is split into segments, the path can include "{timestamp}" and
+// "{seq}" placeholders, which are replaced with the time of the segment's
+// first frame and the sequence number of the segment
+// (e.g. /data/camera1_{timestamp}.avi). When the name of a new segment is
+// already used, "_1", "_2", ... is appended to the name.
+//
+// fps: Frame per second of the output video, default is 30.
+//
+// codec: FourCC code of the codec, default is "MJPG".
+//
+// width: Frame width, if set empty or "0" then the first frame's width is
+// used.
+//
+// height: Frame height, if set empty or "0" then the first frame's height is
+// used.
+//
+// "width" and "height" are required to be given together. When they are
+// given, frames of a different size are resized to the size. Otherwise, all
+// frames are required to have the same size as the first frame.
+//
+// timestamp_format: The layout of "{timestamp}" placeholder as Go's time
+// format, default is "20060102T150405".
+//
+// segment_duration: The maximum duration of a segment in seconds, which is
+// measured by tuples' timestamp. If set empty or "0" then will be ignored.
+//
+// segment_frames: The maximum number of frames of a segment. If set empty or
+// "0" then will be ignored.
+//
+// max_segments: The number of segments to retain, the oldest segment written
+// by the sink is deleted when exceeded. If set empty or "0" then all segments
+// are retained.
+func (c *VideoWriterCreator) CreateSink(ctx *core.Context,
+	ioParams *bql.IOParams, params data.Map) (core.Sink, error) {
+	return c.createVideoWriter(ctx, ioParams, params)
+}
+
+func (c *VideoWriterCreator) createVideoWriter(ctx *core.Context,
+	ioParams *bql.IOParams, params data.Map) (*videoWriterSink, error) {
+	var fileName string
+	if fn, err := params.Get(configFilePath); err != nil {
+		return nil, fmt.Errorf("video writer needs file name")
+	} else if fileName, err = data.AsString(fn); err != nil {
+		return nil, err
+	}
+
+	fps := 30.0
+	if f, err := params.Get(fpsPath); err == nil {
+		if fps, err = data.ToFloat(f); err != nil {
+			return nil, err
+		}
+		if fps <= 0 {
+			return nil, fmt.Errorf("fps must be greater than 0: %v", fps)
+		}
+	}
+
+	codec := "MJPG"
+	if cd, err := params.Get(codecPath); err == nil {
+		if codec, err = data.AsString(cd); err != nil {
+			return nil, err
+		}
+	}
+	fourcc, err := toFourCC(codec)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := params.Get(widthPath)
+	if err != nil {
+		w = data.Int(0) // will be ignored
+	}
+	width, err := data.AsInt(w)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := params.Get(heightPath)
+	if err != nil {
+		h = data.Int(0) // will be ignored
+	}
+	height, err := data.AsInt(h)
+	if err != nil {
+		return nil, err
+	}
+
+	if (width > 0) != (height > 0) {
+		return nil, fmt.Errorf("width and height must be given together: %vx%v",
+			width, height)
+	}
+
+	timestampFormat := "20060102T150405"
+	if tf, err := params.Get(timestampFormatPath); err == nil {
+		if timestampFormat, err = data.AsString(tf); err != nil {
+			return nil, err
+		}
+	}
+
+	sd, err := params.Get(segmentDurationPath)
+	if err != nil {
+		sd = data.Int(0) // will be ignored
+	}
+	segmentDuration, err := data.ToFloat(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	sf, err := params.Get(segmentFramesPath)
+	if err != nil {
+		sf = data.Int(0) // will be ignored
+	}
+	segmentFrames, err := data.AsInt(sf)
+	if err != nil {
+		return nil, err
+	}
+
+	ms, err := params.Get(maxSegmentsPath)
+	if err != nil {
+		ms = data.Int(0) // will be ignored
+	}
+	maxSegments, err := data.AsInt(ms)
+	if err != nil {
+		return nil, err
+	}
+
+	if segmentDuration > 0 || segmentFrames > 0 {
+		if !strings.Contains(fileName, fileNameTimestamp) &&
+			!strings.Contains(fileName, fileNameSequence) {
+			return nil, fmt.Errorf(
+				"file name needs %v or %v placeholder to split segments: %v",
+				fileNameTimestamp, fileNameSequence, fileName)
+		}
+	}
+
+	return &videoWriterSink{
+		fileName:        fileName,
+		fps:             fps,
+		fourcc:          fourcc,
+		width:           int(width),
+		height:          int(height),
+		resize:          width > 0 && height > 0,
+		timestampFormat: timestampFormat,
+		segmentDuration: time.Duration(segmentDuration * float64(time.Second)),
+		segmentFrames:   segmentFrames,
+		maxSegments:     int(maxSegments),
+	}, nil
+}
+
+func toFourCC(codec string) (int, error) {
+	if len(codec) != 4 {
+		return 0, fmt.Errorf("codec must be 4 characters: '%v'", codec)
+	}
+	return bridge.FourCC(codec[0], codec[1], codec[2], codec[3]), nil
+}
+
+type videoWriterSink struct {
+	fileName        string
+	fps             float64
+	fourcc          int
+	width           int
+	height          int
+	resize          bool
+	timestampFormat string
+	segmentDuration time.Duration
+	segmentFrames   int64
+	maxSegments     int
+
+	mu     sync.Mutex
+	vw     *bridge.VideoWriter
+	closed bool
+
+	seq          int64
+	segments     []string
+	segmentStart time.Time
+	frameCount   int64
+}
+
+// Write writes the tuple's frame to the video file. The video file is opened
+// when the first frame is written. Frames are resized to the video size when
+// the size is configured, otherwise all frames are required to have the same
+// size. When the current segment exceeds the segment duration or the
+// number of segment frames, the file is closed and a new segment is opened.
+func (s *videoWriterSink) Write(ctx *core.Context, t *core.Tuple) error {
+	raw, err := ConvertMapToRawData(t.Data)
+	if err != nil {
+		return err
+	}
+	mat, err := raw.ToMatVec3b()
+	if err != nil {
+		return err
+	}
+	defer mat.Delete()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("video writer is already closed: %v", s.fileName)
+	}
+	if s.vw != nil && s.segmentExceeded(t.Timestamp) {
+		s.releaseWriter()
+	}
+	if s.vw == nil {
+		if s.width <= 0 || s.height <= 0 {
+			s.width = raw.Width
+			s.height = raw.Height
+		}
+		if err := s.openSegment(ctx, t.Timestamp); err != nil {
+			return err
+		}
+	}
+	frame := mat
+	if raw.Width != s.width || raw.Height != s.height {
+		if !s.resize {
+			return fmt.Errorf("frame size %dx%d does not match video size %dx%d",
+				raw.Width, raw.Height, s.width, s.height)
+		}
+		resized, err := resizeMatVec3b(mat, s.width, s.height)
+		if err != nil {
+			return err
+		}
+		defer resized.Delete()
+		frame = resized
+	}
+	s.vw.Write(frame)
+	s.frameCount++
+	return nil
+}
+
+func resizeMatVec3b(m bridge.MatVec3b, width, height int) (bridge.MatVec3b,
+	error) {
+	mat := m.ToMat()
+	defer mat.Delete()
+	resized := mat.Resize(width, height, bridge.CvInterLinear)
+	defer resized.Delete()
+	ret, ok := resized.ToMatVec3b()
+	if !ok {
+		return bridge.MatVec3b{}, fmt.Errorf("cannot resize frame to %dx%d",
+			width, height)
+	}
+	return ret, nil
+}
+
+func (s *videoWriterSink) segmentExceeded(ts time.Time) bool {
+	if s.segmentFrames > 0 && s.frameCount >= s.segmentFrames {
+		return true
+	}
+	if s.segmentDuration > 0 && ts.Sub(s.segmentStart) >= s.segmentDuration {
+		return true
+	}
+	return false
+}
+
+func (s *videoWriterSink) segmentFileName(ts time.Time) string {
+	name := strings.Replace(s.fileName, fileNameTimestamp,
+		ts.Format(s.timestampFormat), -1)
+	return strings.Replace(name, fileNameSequence,
+		strconv.FormatInt(s.seq, 10), -1)
+}
+
+// newSegmentFileName returns the file name of a new segment. When segments
+// are split and the name is already used by another segment or file, e.g.
+// segments rotated within the resolution of "{timestamp}", a suffix of "_1",
+// "_2", ... is appended to the name instead of overwriting the file.
+func (s *videoWriterSink) newSegmentFileName(ts time.Time) string {
+	name := s.segmentFileName(ts)
+	if s.segmentDuration <= 0 && s.segmentFrames <= 0 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; s.segmentFileExists(name); i++ {
+		name = fmt.Sprintf("%v_%d%v", base, i, ext)
+	}
+	return name
+}
+
+func (s *videoWriterSink) segmentFileExists(name string) bool {
+	for _, seg := range s.segments {
+		if seg == name {
+			return true
+		}
+	}
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func (s *videoWriterSink) openSegment(ctx *core.Context, ts time.Time) error {
+	name := s.newSegmentFileName(ts)
+	vw := bridge.NewVideoWriter()
+	vw.OpenWithCodec(name, s.fourcc, s.fps, s.width, s.height)
+	if !vw.IsOpened() {
+		vw.Delete()
+		return fmt.Errorf("error opening video writer: %v", name)
+	}
+	s.vw = &vw
+	s.seq++
+	s.segmentStart = ts
+	s.frameCount = 0
+	ctx.Log().Infof("start writing video file: %v", name)
+
+	s.segments = appendSegment(s.segments, name)
+	if s.maxSegments > 0 && len(s.segments) > s.maxSegments {
+		for _, old := range s.segments[:len(s.segments)-s.maxSegments] {
+			if old == name {
+				continue // never remove the segment being written
+			}
+			if err := os.Remove(old); err != nil {
+				ctx.Log().Warnf("cannot remove an old video segment '%v': %v",
+					old, err)
+			}
+		}
+		s.segments = s.segments[len(s.segments)-s.maxSegments:]
+	}
+	return nil
+}
+
+// appendSegment appends the name to the segments, and moves the name to the
+// last when it is already included.
+func appendSegment(segments []string, name string) []string {
+	for i, seg := range segments {
+		if seg == name {
+			segments = append(segments[:i], segments[i+1:]...)
+			break
+		}
+	}
+	return append(segments, name)
+}
+
+func (s *videoWriterSink) releaseWriter() {
+	s.vw.Release()
+	s.vw.Delete()
+	s.vw = nil
+}
+
+// Close releases the video writer and completes writing the video file.
+func (s *videoWriterSink) Close(ctx *core.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.vw != nil {
+		s.releaseWriter()
+	}
+	return nil
+}
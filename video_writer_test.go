@@ -0,0 +1,379 @@
+package opencv
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/sensorbee/opencv.v0/bridge"
+	"gopkg.in/sensorbee/sensorbee.v0/bql"
+	"gopkg.in/sensorbee/sensorbee.v0/core"
+	"gopkg.in/sensorbee/sensorbee.v0/data"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetVideoWriterCreator(t *testing.T) {
+	ctx := &core.Context{}
+	ioParams := &bql.IOParams{}
+	Convey("Given a VideoWriter creator", t, func() {
+		sc := VideoWriterCreator{}
+		Convey("When create sink with full parameters", func() {
+			params := data.Map{
+				"file":   data.String("/data/record.avi"),
+				"fps":    data.Float(15),
+				"codec":  data.String("XVID"),
+				"width":  data.Int(640),
+				"height": data.Int(480),
+			}
+			Convey("Then creator should initialize video writer sink", func() {
+				s, err := sc.createVideoWriter(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+				So(s.fileName, ShouldEqual, "/data/record.avi")
+				So(s.fps, ShouldEqual, 15)
+				So(s.fourcc, ShouldEqual, bridge.FourCC('X', 'V', 'I', 'D'))
+				So(s.width, ShouldEqual, 640)
+				So(s.height, ShouldEqual, 480)
+			})
+		})
+
+		Convey("When create sink with only file name", func() {
+			params := data.Map{
+				"file": data.String("/data/record.avi"),
+			}
+			Convey("Then sink should set default values", func() {
+				s, err := sc.createVideoWriter(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+				So(s.fps, ShouldEqual, 30)
+				So(s.fourcc, ShouldEqual, bridge.FourCC('M', 'J', 'P', 'G'))
+				So(s.width, ShouldEqual, 0)
+				So(s.height, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When create sink with segment options", func() {
+			params := data.Map{
+				"file":             data.String("/data/camera1_{timestamp}.avi"),
+				"timestamp_format": data.String("20060102T1504"),
+				"segment_duration": data.Float(1.5),
+				"segment_frames":   data.Int(100),
+				"max_segments":     data.Int(3),
+			}
+			Convey("Then creator should initialize segment settings", func() {
+				s, err := sc.createVideoWriter(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+				So(s.timestampFormat, ShouldEqual, "20060102T1504")
+				So(s.segmentDuration, ShouldEqual, 1500*time.Millisecond)
+				So(s.segmentFrames, ShouldEqual, 100)
+				So(s.maxSegments, ShouldEqual, 3)
+			})
+			Convey("Then the segment file name should be expanded", func() {
+				s, err := sc.createVideoWriter(ctx, ioParams, params)
+				So(err, ShouldBeNil)
+				ts := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+				So(s.segmentFileName(ts), ShouldEqual,
+					"/data/camera1_20261017T1200.avi")
+			})
+		})
+
+		Convey("When create sink with only width or height", func() {
+			Convey("Then creator should occur an error", func() {
+				for _, size := range []data.Map{
+					{"width": data.Int(640)},
+					{"height": data.Int(480)},
+				} {
+					params := data.Map{"file": data.String("/data/record.avi")}
+					for k, v := range size {
+						params[k] = v
+					}
+					s, err := sc.createVideoWriter(ctx, ioParams, params)
+					So(err, ShouldNotBeNil)
+					So(s, ShouldBeNil)
+				}
+			})
+		})
+
+		Convey("When create sink with segment options without placeholders", func() {
+			params := data.Map{
+				"file":           data.String("/data/record.avi"),
+				"segment_frames": data.Int(100),
+			}
+			Convey("Then creator should occur an error", func() {
+				s, err := sc.createVideoWriter(ctx, ioParams, params)
+				So(err, ShouldNotBeNil)
+				So(s, ShouldBeNil)
+			})
+		})
+
+		Convey("When create sink with empty file name", func() {
+			params := data.Map{}
+			Convey("Then creator should occur an error", func() {
+				s, err := sc.CreateSink(ctx, ioParams, params)
+				So(err, ShouldNotBeNil)
+				So(s, ShouldBeNil)
+			})
+		})
+
+		Convey("When create sink with invalid option parameters", func() {
+			params := data.Map{
+				"file": data.String("/data/record.avi"),
+			}
+			testMap := data.Map{
+				"fps":              data.String("a"),
+				"codec":            data.String("MPEG4"),
+				"width":            data.String("b"),
+				"height":           data.String("c"),
+				"timestamp_format": data.Int(1),
+				"segment_duration": data.String("d"),
+				"segment_frames":   data.String("e"),
+				"max_segments":     data.String("f"),
+			}
+			for k, v := range testMap {
+				v := v
+				msg := fmt.Sprintf("with %v error", k)
+				Convey("Then creator should occur a parse error on option parameters "+msg,
+					func() {
+						params[k] = v
+						s, err := sc.createVideoWriter(ctx, ioParams, params)
+						So(err, ShouldNotBeNil)
+						So(s, ShouldBeNil)
+					})
+			}
+		})
+	})
+}
+
+func TestVideoWriterSinkWrite(t *testing.T) {
+	ctx := core.NewContext(nil)
+	ioParams := &bql.IOParams{}
+	Convey("Given a video writer sink", t, func() {
+		fileName := "_test_video_writer.avi"
+		Reset(func() {
+			os.Remove(fileName)
+		})
+		sc := VideoWriterCreator{}
+		params := data.Map{
+			"file": data.String(fileName),
+			"fps":  data.Int(10),
+		}
+		s, err := sc.CreateSink(ctx, ioParams, params)
+		So(err, ShouldBeNil)
+
+		Convey("When write frames and close the sink", func() {
+			for i := 0; i < 5; i++ {
+				err := s.Write(ctx, &core.Tuple{Data: testRawData(64, 48).ConvertToDataMap()})
+				So(err, ShouldBeNil)
+			}
+			So(s.Close(ctx), ShouldBeNil)
+
+			Convey("Then the video file should contain all frames", func() {
+				vcap := bridge.NewVideoCapture()
+				defer vcap.Delete()
+				So(vcap.Open(fileName), ShouldBeTrue)
+				buf := bridge.NewMatVec3b()
+				defer buf.Delete()
+				cnt := 0
+				for vcap.Read(buf) {
+					cnt++
+				}
+				So(cnt, ShouldEqual, 5)
+			})
+
+			Convey("Then writing to the closed sink should occur an error", func() {
+				err := s.Write(ctx, &core.Tuple{Data: testRawData(64, 48).ConvertToDataMap()})
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When write frames which have different size", func() {
+			err := s.Write(ctx, &core.Tuple{Data: testRawData(64, 48).ConvertToDataMap()})
+			So(err, ShouldBeNil)
+			Reset(func() {
+				s.Close(ctx)
+			})
+			Convey("Then the sink should occur an error", func() {
+				err := s.Write(ctx, &core.Tuple{Data: testRawData(32, 24).ConvertToDataMap()})
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When write frames to a sink which has the video size", func() {
+			params["width"] = data.Int(32)
+			params["height"] = data.Int(24)
+			s, err := sc.CreateSink(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			for _, size := range [][2]int{{64, 48}, {32, 24}, {16, 16}} {
+				err := s.Write(ctx, &core.Tuple{Data: testRawData(size[0], size[1]).ConvertToDataMap()})
+				So(err, ShouldBeNil)
+			}
+			So(s.Close(ctx), ShouldBeNil)
+
+			Convey("Then frames should be resized to the video size", func() {
+				vcap := bridge.NewVideoCapture()
+				defer vcap.Delete()
+				So(vcap.Open(fileName), ShouldBeTrue)
+				buf := bridge.NewMatVec3b()
+				defer buf.Delete()
+				cnt := 0
+				for vcap.Read(buf) {
+					w, h := buf.Size()
+					So(w, ShouldEqual, 32)
+					So(h, ShouldEqual, 24)
+					cnt++
+				}
+				So(cnt, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When write a tuple which is not RawData", func() {
+			Reset(func() {
+				s.Close(ctx)
+			})
+			Convey("Then the sink should occur an error", func() {
+				err := s.Write(ctx, &core.Tuple{Data: data.Map{}})
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestVideoWriterSinkSegments(t *testing.T) {
+	ctx := core.NewContext(nil)
+	ioParams := &bql.IOParams{}
+	Convey("Given a video writer sink splitting segments", t, func() {
+		dir := "_test_video_segments"
+		So(os.MkdirAll(dir, 0755), ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		sc := VideoWriterCreator{}
+		params := data.Map{
+			"file":             data.String(filepath.Join(dir, "camera1_{seq}.avi")),
+			"segment_duration": data.Int(1),
+			"segment_frames":   data.Int(3),
+		}
+
+		Convey("When write frames exceeding the number of segment frames", func() {
+			s, err := sc.CreateSink(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			now := time.Now()
+			for i := 0; i < 7; i++ {
+				err := s.Write(ctx, &core.Tuple{Data: testRawData(64, 48).ConvertToDataMap(),
+					Timestamp: now})
+				So(err, ShouldBeNil)
+			}
+			So(s.Close(ctx), ShouldBeNil)
+			Convey("Then frames should be split into segments", func() {
+				files, err := filepath.Glob(filepath.Join(dir, "*.avi"))
+				So(err, ShouldBeNil)
+				So(len(files), ShouldEqual, 3)
+			})
+		})
+
+		Convey("When write frames exceeding the segment duration", func() {
+			s, err := sc.CreateSink(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			now := time.Now()
+			for i := 0; i < 4; i++ {
+				ts := now.Add(time.Duration(i) * 600 * time.Millisecond)
+				err := s.Write(ctx, &core.Tuple{Data: testRawData(64, 48).ConvertToDataMap(),
+					Timestamp: ts})
+				So(err, ShouldBeNil)
+			}
+			So(s.Close(ctx), ShouldBeNil)
+			Convey("Then frames should be split by timestamp", func() {
+				files, err := filepath.Glob(filepath.Join(dir, "*.avi"))
+				So(err, ShouldBeNil)
+				So(len(files), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When write segments exceeding the retention limit", func() {
+			params["max_segments"] = data.Int(2)
+			s, err := sc.CreateSink(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			now := time.Now()
+			for i := 0; i < 12; i++ {
+				err := s.Write(ctx, &core.Tuple{Data: testRawData(64, 48).ConvertToDataMap(),
+					Timestamp: now})
+				So(err, ShouldBeNil)
+			}
+			So(s.Close(ctx), ShouldBeNil)
+			Convey("Then the oldest segments should be deleted", func() {
+				files, err := filepath.Glob(filepath.Join(dir, "*.avi"))
+				So(err, ShouldBeNil)
+				So(files, ShouldResemble, []string{
+					filepath.Join(dir, "camera1_2.avi"),
+					filepath.Join(dir, "camera1_3.avi"),
+				})
+			})
+		})
+	})
+}
+
+func TestVideoWriterSinkFastRotation(t *testing.T) {
+	ctx := core.NewContext(nil)
+	ioParams := &bql.IOParams{}
+	Convey("Given a video writer sink with a timestamp-only file name", t, func() {
+		dir := "_test_video_fast_rotation"
+		So(os.MkdirAll(dir, 0755), ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		sc := VideoWriterCreator{}
+		params := data.Map{
+			"file":           data.String(filepath.Join(dir, "camera1_{timestamp}.avi")),
+			"segment_frames": data.Int(2),
+		}
+		ts := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+		Convey("When segments rotate within the same second", func() {
+			s, err := sc.createVideoWriter(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			for i := 0; i < 6; i++ {
+				err := s.Write(ctx, &core.Tuple{Data: testRawData(64, 48).ConvertToDataMap(),
+					Timestamp: ts})
+				So(err, ShouldBeNil)
+			}
+			So(s.Close(ctx), ShouldBeNil)
+			Convey("Then each segment should be written to a distinct file", func() {
+				So(s.segments, ShouldResemble, []string{
+					filepath.Join(dir, "camera1_20261017T120000.avi"),
+					filepath.Join(dir, "camera1_20261017T120000_1.avi"),
+					filepath.Join(dir, "camera1_20261017T120000_2.avi"),
+				})
+				files, err := filepath.Glob(filepath.Join(dir, "*.avi"))
+				So(err, ShouldBeNil)
+				So(len(files), ShouldEqual, 3)
+			})
+		})
+
+		Convey("When segments rotate within the same second with retention", func() {
+			params["max_segments"] = data.Int(2)
+			s, err := sc.createVideoWriter(ctx, ioParams, params)
+			So(err, ShouldBeNil)
+			for i := 0; i < 6; i++ {
+				err := s.Write(ctx, &core.Tuple{Data: testRawData(64, 48).ConvertToDataMap(),
+					Timestamp: ts})
+				So(err, ShouldBeNil)
+			}
+			So(s.Close(ctx), ShouldBeNil)
+			Convey("Then the live segment should not be deleted", func() {
+				last := filepath.Join(dir, "camera1_20261017T120000_2.avi")
+				vcap := bridge.NewVideoCapture()
+				defer vcap.Delete()
+				So(vcap.Open(last), ShouldBeTrue)
+				buf := bridge.NewMatVec3b()
+				defer buf.Delete()
+				cnt := 0
+				for vcap.Read(buf) {
+					cnt++
+				}
+				So(cnt, ShouldEqual, 2)
+				files, err := filepath.Glob(filepath.Join(dir, "*.avi"))
+				So(err, ShouldBeNil)
+				So(len(files), ShouldEqual, 2)
+			})
+		})
+	})
+}